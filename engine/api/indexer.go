@@ -3,6 +3,7 @@ package api
 import (
 	"bufio"
 	"os"
+	"strconv"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -64,6 +65,68 @@ func (r *Indexer) AddIndex(name string, fields map[string]uint64) error {
 	return nil
 }
 
+// AddFields adds new fields to an existing index
+func (r *Indexer) AddFields(index string, fields map[string]uint64) error {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return errors.New("index not found")
+	}
+	return idx.AddFields(fields)
+}
+
+// DeprecateField stops indexing a field of the index for new documents
+func (r *Indexer) DeprecateField(index string, field string) error {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return errors.New("index not found")
+	}
+	return idx.DeprecateField(field)
+}
+
+// SetSearchFields sets default search fields like "title^3" of the index and how words match across them
+func (r *Indexer) SetSearchFields(index string, fields []string, mode string) error {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return errors.New("index not found")
+	}
+	if len(fields) > 0 {
+		if err := idx.SetDefaultFields(fields); err != nil {
+			return err
+		}
+	}
+	if mode != "" {
+		return idx.SetMultiFieldMode(mode)
+	}
+	return nil
+}
+
+// SetSimilarities sets similarities of string fields of the index by name, e.g. "bm25", "tfidf" or "constant"
+func (r *Indexer) SetSimilarities(name string, similarities map[string]string) error {
+	idx, ok := r.Indexes[name]
+	if !ok {
+		return errors.New("index not found")
+	}
+	for field, similarity := range similarities {
+		s, err := index.NewSimilarity(similarity)
+		if err != nil {
+			return err
+		}
+		if err = idx.SetSimilarity(field, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetBM25 sets BM25 parameters of a string field of the index
+func (r *Indexer) SetBM25(index string, field string, k1, b float64) error {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return errors.New("index not found")
+	}
+	return idx.SetBM25(field, k1, b)
+}
+
 // LoadDocumentsFromFile inserts documents into indexer
 func (r *Indexer) LoadDocumentsFromFile(index string, file string, fieldType string, fields []string) error {
 	fd, err := os.Open(file)
@@ -96,25 +159,198 @@ func (r *Indexer) LoadDocumentsFromFile(index string, file string, fieldType str
 				return errors.Wrap(err, "failed to add document into indexer")
 			}
 		}
+		if fieldType == "json" {
+			// one json document per line
+			txt := scanner.Bytes()
+			if len(txt) == 0 {
+				continue
+			}
+			if err = r.Indexes[index].AddJSONDocument(txt); err != nil {
+				log.Errorf("failed to add document %s into indexer, err: %s\n", txt, err.Error())
+				return errors.Wrap(err, "failed to add document into indexer")
+			}
+		}
 	}
 	return r.Indexes[index].SyncToDisk()
 }
 
-// Search searches everything
-func (r *Indexer) Search(index string, query string) ([]map[string]string, bool) {
-	docs, found := r.Indexes[index].Search(query)
-	if !found {
-		return nil, false
+// AddJSONDocument inserts a json document into index, it's searchable after the index is refreshed
+func (r *Indexer) AddJSONDocument(index string, data []byte) ([]string, error) {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return nil, errors.New("index not found")
+	}
+	queries, err := idx.PercolateJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if err = idx.AddJSONDocument(data); err != nil {
+		return nil, err
 	}
-	var results []map[string]string
-	for _, doc := range docs {
-		d, ok := r.Indexes[index].GetDocument(doc.DocID)
-		if ok {
-			results = append(results, d)
+	return queries, nil
+}
+
+// Refresh makes documents added since the last refresh searchable by syncing the index to disk
+func (r *Indexer) Refresh(index string) error {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return errors.New("index not found")
+	}
+	return idx.SyncToDisk()
+}
+
+// RegisterQuery adds or replaces a standing query of the index which documents are percolated against
+func (r *Indexer) RegisterQuery(index string, id string, query string) error {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return errors.New("index not found")
+	}
+	return idx.Percolator().Register(id, query)
+}
+
+// DeleteQuery removes a standing query of the index
+func (r *Indexer) DeleteQuery(index string, id string) error {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return errors.New("index not found")
+	}
+	deleted, err := idx.Percolator().Delete(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.Errorf("query %s not found", id)
+	}
+	return nil
+}
+
+// Percolate returns ids of standing queries the json document matches without adding it
+func (r *Indexer) Percolate(index string, data []byte) ([]string, error) {
+	idx, ok := r.Indexes[index]
+	if !ok {
+		return nil, errors.New("index not found")
+	}
+	return idx.PercolateJSON(data)
+}
+
+// SearchHits are a page of documents and the number of matched documents,
+// total relation is index.TotalAtLeast if documents which can't rank in the page are skipped without counting,
+// search after are sort values of the last document to get the next page,
+// collapsed are documents collapsed into each document of the page if documents are collapsed,
+// highlights are highlighted fragments of fields of each document of the page if asked
+type SearchHits struct {
+	Docs          []map[string]string
+	Total         int
+	TotalRelation string
+	SearchAfter   index.SortValues
+	Collapsed     []*CollapsedHits
+	Highlights    []map[string][]string
+}
+
+// CollapsedHits are documents collapsed into a document of the page by the value of the collapse field
+type CollapsedHits struct {
+	Value     string              `json:"value"`
+	Count     int                 `json:"count,omitempty"`
+	InnerHits []map[string]string `json:"inner_hits,omitempty"`
+}
+
+// SearchDSL searches by a structured request, returns a page of documents with selected fields and the total
+func (r *Indexer) SearchDSL(name string, req *index.SearchRequest) (*SearchHits, error) {
+	idx, ok := r.Indexes[name]
+	if !ok {
+		return nil, errors.New("index not found")
+	}
+	result, err := idx.SearchDSL(req)
+	if err != nil {
+		return nil, err
+	}
+	return newSearchHits(idx, result, req.Sort, req.Fields), nil
+}
+
+// newSearchHits loads stored fields of documents in the page only
+func newSearchHits(idx *index.Index, result *index.SearchResult, sortFields []index.SortField, fields []string) *SearchHits {
+	hits := &SearchHits{Total: result.Total, TotalRelation: result.TotalRelation}
+	for i, doc := range result.Docs {
+		d, ok := loadDocument(idx, doc, fields)
+		if !ok {
+			continue
 		}
+		hits.Docs = append(hits.Docs, d)
+		if result.Highlights != nil {
+			hits.Highlights = append(hits.Highlights, result.Highlights[i])
+		}
+		if result.Collapsed == nil {
+			continue
+		}
+		collapsed := &CollapsedHits{Value: result.Collapsed[i].Value, Count: result.Collapsed[i].Count}
+		for _, inner := range result.Collapsed[i].Docs {
+			if d, ok := loadDocument(idx, inner, fields); ok {
+				collapsed.InnerHits = append(collapsed.InnerHits, d)
+			}
+		}
+		hits.Collapsed = append(hits.Collapsed, collapsed)
+	}
+	if len(result.Docs) > 0 {
+		hits.SearchAfter = idx.SortValues(result.Docs[len(result.Docs)-1], sortFields)
 	}
-	if len(results) == 0 {
+	return hits
+}
+
+// loadDocument loads selected stored fields of a document, or all of them if none is selected, with its score
+func loadDocument(idx *index.Index, doc index.Doc, fields []string) (map[string]string, bool) {
+	d, ok := idx.GetDocument(doc.DocID)
+	if !ok {
 		return nil, false
 	}
-	return results, true
+	if len(fields) > 0 {
+		selected := map[string]string{"docid": d["docid"]}
+		for _, field := range fields {
+			if v, ok := d[field]; ok {
+				selected[field] = v
+			}
+		}
+		d = selected
+	}
+	d["_score"] = strconv.FormatFloat(doc.Score, 'f', -1, 64)
+	return d, true
+}
+
+// Explain tells how a document of the index matches the query, the error is an *index.ParseError if query is invalid
+func (r *Indexer) Explain(name string, query string, docid uint64) (*index.Explanation, error) {
+	idx, ok := r.Indexes[name]
+	if !ok {
+		return nil, errors.New("index not found")
+	}
+	return idx.Explain(query, docid)
+}
+
+// Search searches everything, the error is an *index.ParseError if query is invalid
+func (r *Indexer) Search(name string, query string) ([]map[string]string, error) {
+	hits, err := r.SearchWithOptions(name, query, index.SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return hits.Docs, nil
+}
+
+// SearchWithOptions searches a page of documents sorted by options, the error is an *index.ParseError if query is invalid
+func (r *Indexer) SearchWithOptions(name string, query string, opts index.SearchOptions) (*SearchHits, error) {
+	idx, ok := r.Indexes[name]
+	if !ok {
+		return nil, errors.New("index not found")
+	}
+	result, err := idx.SearchWithOptions(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newSearchHits(idx, result, opts.Sort, nil), nil
+}
+
+// ValidateQuery checks syntax of query, the error is an *index.ParseError if query is invalid
+func (r *Indexer) ValidateQuery(name string, query string) error {
+	idx, ok := r.Indexes[name]
+	if !ok {
+		return errors.New("index not found")
+	}
+	return idx.ValidateQuery(query)
 }
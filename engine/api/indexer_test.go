@@ -1,8 +1,10 @@
 package api
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/cosmtrek/violet/engine/index"
 	"github.com/cosmtrek/violet/pkg/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -14,3 +16,220 @@ func TestNewIndexer(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, indexer)
 }
+
+func TestIndexer_SearchDSL(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"title": index.TString, "likes": index.TNumber}))
+	idx := indexer.Indexes["violet"]
+	assert.Nil(t, idx.AddDocument(map[string]string{"title": "tom brady super bowl", "likes": "10"}))
+	assert.Nil(t, idx.AddDocument(map[string]string{"title": "tom hanks movie", "likes": "20"}))
+	assert.Nil(t, idx.SyncToDisk())
+
+	var req index.SearchRequest
+	assert.Nil(t, json.Unmarshal([]byte(`{"query": {"match": {"title": "tom"}}, "sort": [{"likes": "desc"}],
+		"size": 1, "fields": ["title"]}`), &req))
+	hits, err := indexer.SearchDSL("violet", &req)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, hits.Total)
+	assert.Equal(t, index.TotalEqual, hits.TotalRelation)
+	assert.Equal(t, 1, len(hits.Docs))
+	assert.Equal(t, "1", hits.Docs[0]["docid"])
+	assert.Equal(t, "tom hanks movie", hits.Docs[0]["title"])
+	assert.NotEmpty(t, hits.Docs[0]["_score"])
+	_, err = indexer.SearchDSL("none", &req)
+	assert.NotNil(t, err)
+}
+
+func TestIndexer_Explain(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"title": index.TString}))
+	assert.Nil(t, indexer.Indexes["violet"].AddDocument(map[string]string{"title": "tom brady"}))
+	assert.Nil(t, indexer.Indexes["violet"].SyncToDisk())
+
+	explanation, err := indexer.Explain("violet", "tom", 0)
+	assert.Nil(t, err)
+	assert.True(t, explanation.Matched)
+	_, err = indexer.Explain("violet", "(tom", 0)
+	assert.Equal(t, &index.ParseError{Pos: 0, Reason: "missing ')' for '('"}, err)
+	_, err = indexer.Explain("none", "tom", 0)
+	assert.NotNil(t, err)
+}
+
+func TestIndexer_Search_InvalidQuery(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"title": index.TString}))
+	assert.Nil(t, indexer.Indexes["violet"].AddDocument(map[string]string{"title": "tom brady"}))
+	assert.Nil(t, indexer.Indexes["violet"].SyncToDisk())
+
+	docs, err := indexer.Search("violet", "tom")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(docs))
+	docs, err = indexer.Search("violet", "matt")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(docs))
+	_, err = indexer.Search("violet", "(tom")
+	assert.Equal(t, &index.ParseError{Pos: 0, Reason: "missing ')' for '('"}, err)
+	assert.Equal(t, err, indexer.ValidateQuery("violet", "(tom"))
+	assert.Nil(t, indexer.ValidateQuery("violet", "tom"))
+	_, err = indexer.Search("none", "tom")
+	assert.NotNil(t, err)
+}
+
+func TestIndexer_Percolate(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"text": index.TString}))
+	assert.Nil(t, indexer.RegisterQuery("violet", "alert", "violet -spam"))
+	assert.NotNil(t, indexer.RegisterQuery("violet", "bad", "(violet"))
+
+	queries, err := indexer.Percolate("violet", []byte(`{"text": "violet is fast"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"alert"}, queries)
+	queries, err = indexer.AddJSONDocument("violet", []byte(`{"text": "violet spam"}`))
+	assert.Nil(t, err)
+	assert.Nil(t, queries)
+	assert.Nil(t, indexer.DeleteQuery("violet", "alert"))
+	assert.NotNil(t, indexer.DeleteQuery("violet", "alert"))
+}
+
+func TestIndexer_SetBM25(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"title": index.TString, "likes": index.TNumber}))
+	assert.Nil(t, indexer.SetBM25("violet", "title", 2, 0.5))
+	assert.Equal(t, 2.0, indexer.Indexes["violet"].Fields["title"].K1)
+	assert.NotNil(t, indexer.SetBM25("violet", "likes", 2, 0.5))
+	assert.NotNil(t, indexer.SetBM25("none", "title", 2, 0.5))
+}
+
+func TestIndexer_SetSimilarities(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	fields, _, similarities, err := parseFields("title-0-tfidf,text-0,likes-1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"title": index.SimilarityTFIDF}, similarities)
+	assert.Nil(t, indexer.AddIndex("violet", fields))
+	assert.Nil(t, indexer.SetSimilarities("violet", similarities))
+	assert.Equal(t, index.SimilarityTFIDF, indexer.Indexes["violet"].Fields["title"].Similarity)
+	assert.NotNil(t, indexer.SetSimilarities("violet", map[string]string{"title": "none"}))
+	assert.NotNil(t, indexer.SetSimilarities("violet", map[string]string{"likes": index.SimilarityConstant}))
+	_, _, _, err = parseFields("title-0-tfidf-x")
+	assert.NotNil(t, err)
+}
+
+func TestIndexer_SearchWithOptions(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"text": index.TString, "author": index.TKeyword}))
+	assert.Nil(t, indexer.Indexes["violet"].AddDocument(map[string]string{"text": "super bowl", "author": "tom"}))
+	assert.Nil(t, indexer.Indexes["violet"].AddDocument(map[string]string{"text": "super bowl", "author": "matt"}))
+	assert.Nil(t, indexer.Indexes["violet"].SyncToDisk())
+
+	sortFields, err := index.ParseSort("author")
+	assert.Nil(t, err)
+	hits, err := indexer.SearchWithOptions("violet", "super", index.SearchOptions{Sort: sortFields})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(hits.Docs))
+	assert.Equal(t, "matt", hits.Docs[0]["author"])
+
+	// only the page is loaded, the next page is after its last document
+	hits, err = indexer.SearchWithOptions("violet", "super", index.SearchOptions{Sort: sortFields, Size: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, hits.Total)
+	assert.Equal(t, []map[string]string{{"docid": "1", "text": "super bowl", "author": "matt", "_score": hits.Docs[0]["_score"]}},
+		hits.Docs)
+	hits, err = indexer.SearchWithOptions("violet", "super",
+		index.SearchOptions{Sort: sortFields, Size: 1, SearchAfter: hits.SearchAfter})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hits.Docs))
+	assert.Equal(t, "tom", hits.Docs[0]["author"])
+	_, err = indexer.SearchWithOptions("violet", "super", index.SearchOptions{Sort: []index.SortField{{Field: "text"}}})
+	assert.NotNil(t, err)
+}
+
+func TestIndexer_SearchWithOptions_Collapse(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"text": index.TString, "author": index.TKeyword}))
+	idx := indexer.Indexes["violet"]
+	assert.Nil(t, idx.AddDocument(map[string]string{"text": "super bowl", "author": "tom"}))
+	assert.Nil(t, idx.AddDocument(map[string]string{"text": "super bowl party", "author": "tom"}))
+	assert.Nil(t, idx.AddDocument(map[string]string{"text": "super bowl", "author": "matt"}))
+	assert.Nil(t, idx.SyncToDisk())
+
+	sortFields, err := index.ParseSort("_doc")
+	assert.Nil(t, err)
+	hits, err := indexer.SearchWithOptions("violet", "super", index.SearchOptions{Sort: sortFields,
+		Collapse: &index.Collapse{Field: "author", Count: true, InnerHits: 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, hits.Total)
+	assert.Equal(t, 2, len(hits.Docs))
+	assert.Equal(t, "0", hits.Docs[0]["docid"])
+	assert.Equal(t, "2", hits.Docs[1]["docid"])
+	assert.Equal(t, "tom", hits.Collapsed[0].Value)
+	assert.Equal(t, 1, hits.Collapsed[0].Count)
+	assert.Equal(t, "super bowl party", hits.Collapsed[0].InnerHits[0]["text"])
+	assert.Equal(t, &CollapsedHits{Value: "matt"}, hits.Collapsed[1])
+}
+
+func TestIndexer_SearchDSL_Highlight(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"text": index.TString}))
+	idx := indexer.Indexes["violet"]
+	assert.Nil(t, idx.AddDocument(map[string]string{"text": "tom brady super bowl"}))
+	assert.Nil(t, idx.AddDocument(map[string]string{"text": "tom hanks movie"}))
+	assert.Nil(t, idx.SyncToDisk())
+
+	var req index.SearchRequest
+	assert.Nil(t, json.Unmarshal([]byte(`{"query": {"match": {"text": "tom"}}, "sort": ["_doc"],
+		"highlight": {"fields": ["text"]}}`), &req))
+	hits, err := indexer.SearchDSL("violet", &req)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(hits.Docs))
+	assert.Equal(t, []map[string][]string{{"text": {"<em>tom</em> brady super bowl"}}, {"text": {"<em>tom</em> hanks movie"}}},
+		hits.Highlights)
+}
+
+func TestIndexer_AddJSONDocument_Refresh(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	indexer, err := NewIndexer(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.AddIndex("violet", map[string]uint64{"text": index.TString}))
+	_, err = indexer.AddJSONDocument("violet", []byte(`{"text": "violet is fast"}`))
+	assert.Nil(t, err)
+	_, err = indexer.AddJSONDocument("violet", []byte(`{"text": "violet is simple"}`))
+	assert.Nil(t, err)
+
+	// documents are searchable after the index is refreshed
+	docs, err := indexer.Search("violet", "violet")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(docs))
+	assert.Nil(t, indexer.Refresh("violet"))
+	docs, err = indexer.Search("violet", "violet")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(docs))
+	assert.NotNil(t, indexer.Refresh("none"))
+}
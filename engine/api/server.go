@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/cosmtrek/violet/engine/index"
+	"github.com/pkg/errors"
 	"github.com/pressly/chi"
 )
 
@@ -22,6 +24,20 @@ type IndexerRequest struct {
 	IndexPath string `json:"index_path"`
 	Datafile  string `json:"datafile"`
 	Fields    string `json:"fields"`
+	// Type of datafile, "text" by default or "json"
+	Type string `json:"type"`
+	// DefaultFields are string fields searched for words without field, e.g. "title^3,text"
+	DefaultFields string `json:"default_fields"`
+	// MultiFieldMode is "cross_fields" by default or "best_fields"
+	MultiFieldMode string `json:"multi_field_mode"`
+	// BM25 are parameters of string fields scored by BM25, e.g. {"title": {"k1": 1.2, "b": 0.5}}
+	BM25 map[string]BM25Params `json:"bm25"`
+}
+
+// BM25Params are k1 and b of a field, missing ones keep defaults
+type BM25Params struct {
+	K1 *float64 `json:"k1"`
+	B  *float64 `json:"b"`
 }
 
 // Response returns message to client
@@ -30,6 +46,21 @@ type Response struct {
 	Status  string              `json:"status"`
 	Message string              `json:"message,omitempty"`
 	Docs    []map[string]string `json:"docs,omitempty"`
+	// Total is the number of matched documents, docs are a page of them,
+	// total relation is "gte" if the total is a lower bound as documents which can't rank in the page are skipped
+	Total         int    `json:"total,omitempty"`
+	TotalRelation string `json:"total_relation,omitempty"`
+	// SearchAfter are sort values of the last document, passed as search_after to get the next page
+	SearchAfter index.SortValues `json:"search_after,omitempty"`
+	// Collapsed are documents collapsed into each of docs if they are collapsed by a field
+	Collapsed []*CollapsedHits `json:"collapsed,omitempty"`
+	// Highlights are fragments of fields with matched words marked, of each of docs if highlighting is asked
+	Highlights  []map[string][]string `json:"highlights,omitempty"`
+	Explanation *index.Explanation    `json:"explanation,omitempty"`
+	// Error tells the position and reason of an invalid query
+	Error *index.ParseError `json:"error,omitempty"`
+	// Queries are ids of standing queries a document matches
+	Queries []string `json:"queries,omitempty"`
 }
 
 // IndexHandler creates an indexer
@@ -52,13 +83,12 @@ func (h *Handler) IndexHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fieldsMeta := make(map[string]uint64, 0)
-	var fieldsArr []string
-	for _, f := range strings.Split(request.Fields, ",") {
-		fs := strings.Split(f, "-")
-		fs1, _ := strconv.Atoi(fs[1])
-		fieldsMeta[fs[0]] = uint64(fs1)
-		fieldsArr = append(fieldsArr, fs[0])
+	fieldsMeta, fieldsArr, similarities, err := parseFields(request.Fields)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
 	}
 	h.Indexer, err = NewIndexer(request.IndexPath, nil)
 	if err != nil {
@@ -73,7 +103,43 @@ func (h *Handler) IndexHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write(responseFailed("1", err.Error()))
 		return
 	}
-	if err = h.Indexer.LoadDocumentsFromFile(request.Index, request.Datafile, "text", fieldsArr); err != nil {
+	if err = h.Indexer.SetSimilarities(request.Index, similarities); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	var defaultFields []string
+	for _, f := range strings.Split(request.DefaultFields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			defaultFields = append(defaultFields, f)
+		}
+	}
+	if err = h.Indexer.SetSearchFields(request.Index, defaultFields, request.MultiFieldMode); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	for field, params := range request.BM25 {
+		k1, b := index.DefaultK1, index.DefaultB
+		if params.K1 != nil {
+			k1 = *params.K1
+		}
+		if params.B != nil {
+			b = *params.B
+		}
+		if err = h.Indexer.SetBM25(request.Index, field, k1, b); err != nil {
+			log.Errorln(err)
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(responseFailed("1", err.Error()))
+			return
+		}
+	}
+	if request.Type == "" {
+		request.Type = "text"
+	}
+	if err = h.Indexer.LoadDocumentsFromFile(request.Index, request.Datafile, request.Type, fieldsArr); err != nil {
 		log.Errorln(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(responseFailed("1", err.Error()))
@@ -83,6 +149,231 @@ func (h *Handler) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(responseOk("created indexer successfully"))
 }
 
+// FieldsRequest adds fields to an index
+type FieldsRequest struct {
+	Fields string `json:"fields"`
+}
+
+// FieldsHandler adds new fields to an existing index
+func (h *Handler) FieldsHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	var request FieldsRequest
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "failed to read request body"))
+		return
+	}
+	if err = json.Unmarshal(body, &request); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "failed to unmarshal request body"))
+		return
+	}
+	fieldsMeta, _, similarities, err := parseFields(request.Fields)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	if err = h.Indexer.AddFields(indexer, fieldsMeta); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	if err = h.Indexer.SetSimilarities(indexer, similarities); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseOk("added fields successfully"))
+}
+
+// DeprecateFieldHandler stops indexing a field for new documents
+func (h *Handler) DeprecateFieldHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	field := chi.URLParam(r, "field")
+	if err := h.Indexer.DeprecateField(indexer, field); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseOk("deprecated field successfully"))
+}
+
+// DocumentHandler adds a json document into index
+func (h *Handler) DocumentHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "failed to read request body"))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	queries, err := h.Indexer.AddJSONDocument(indexer, body)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	msg := "added document successfully"
+	// the document is added anyway, a failed refresh leaves it unsearchable until the next refresh
+	if r.URL.Query().Get("refresh") == "true" {
+		if err = h.Indexer.Refresh(indexer); err != nil {
+			log.Errorln(err)
+			msg = "added document successfully, but failed to refresh index: " + err.Error()
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseQueries(msg, queries))
+}
+
+// RefreshHandler makes documents added since the last refresh searchable
+func (h *Handler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	if err := h.Indexer.Refresh(chi.URLParam(r, "indexer")); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseOk("refreshed index successfully"))
+}
+
+// QueryRequest registers a standing query
+type QueryRequest struct {
+	Query string `json:"query"`
+}
+
+// RegisterQueryHandler adds or replaces a standing query that documents are percolated against
+func (h *Handler) RegisterQueryHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	var request QueryRequest
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "failed to read request body"))
+		return
+	}
+	if err = json.Unmarshal(body, &request); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "failed to unmarshal request body"))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	err = h.Indexer.RegisterQuery(indexer, chi.URLParam(r, "id"), request.Query)
+	if perr, ok := err.(*index.ParseError); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseInvalidQuery(perr))
+		return
+	}
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseOk("registered query successfully"))
+}
+
+// DeleteQueryHandler removes a standing query
+func (h *Handler) DeleteQueryHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	if err := h.Indexer.DeleteQuery(indexer, chi.URLParam(r, "id")); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseOk("deleted query successfully"))
+}
+
+// PercolateHandler returns ids of standing queries a json document matches without adding it
+func (h *Handler) PercolateHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "failed to read request body"))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	queries, err := h.Indexer.Percolate(indexer, body)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if len(queries) == 0 {
+		w.Write(responseOk("no matched queries"))
+		return
+	}
+	w.Write(responseQueries("matched queries", queries))
+}
+
 // SearchHandler searches everything via http
 func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	// Dirty hack
@@ -94,25 +385,254 @@ func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	indexer := chi.URLParam(r, "indexer")
 	query := r.URL.Query().Get("query")
+	// sort like "created:desc,author:asc:_first"
+	sortFields, err := index.ParseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+
+	opts, err := searchOptions(r)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	opts.Sort = sortFields
 
-	docs, ok := h.Indexer.Search(indexer, query)
-	if ok {
-		resp := Response{
-			Code:   "0",
-			Status: "OK",
-			Docs:   docs,
+	hits, err := h.Indexer.SearchWithOptions(indexer, query, opts)
+	if err != nil {
+		if perr, ok := err.(*index.ParseError); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(responseInvalidQuery(perr))
+			return
 		}
-		data, err := json.Marshal(resp)
-		if err != nil {
-			log.Errorln(err)
-			w.Write([]byte("{}"))
-		} else {
-			w.Write(data)
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	if hits.Total == 0 {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseOk("no data"))
+		return
+	}
+	resp := Response{
+		Code:          "0",
+		Status:        "OK",
+		Docs:          hits.Docs,
+		Total:         hits.Total,
+		TotalRelation: hits.TotalRelation,
+		SearchAfter:   hits.SearchAfter,
+		Collapsed:     hits.Collapsed,
+		Highlights:    hits.Highlights,
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorln(err)
+		w.Write([]byte("{}"))
+		return
+	}
+	w.Write(data)
+}
+
+// searchOptions parses a page of search like "from=10&size=10", or "search_after=[1549152000,3]" with sort values
+// of the last document of the previous page, size is 10 by default
+func searchOptions(r *http.Request) (index.SearchOptions, error) {
+	opts := index.SearchOptions{Size: index.DefaultSearchSize}
+	var err error
+	params := r.URL.Query()
+	if from := params.Get("from"); from != "" {
+		if opts.From, err = strconv.Atoi(from); err != nil {
+			return opts, errors.Errorf("invalid from %s", from)
+		}
+	}
+	if size := params.Get("size"); size != "" {
+		if opts.Size, err = strconv.Atoi(size); err != nil || opts.Size <= 0 {
+			return opts, errors.Errorf("invalid size %s", size)
+		}
+	}
+	if opts.SearchAfter, err = index.ParseSortValues(params.Get("search_after")); err != nil {
+		return opts, err
+	}
+	opts.TrackTotalHits = params.Get("track_total_hits") == "true"
+	if field := params.Get("collapse"); field != "" {
+		opts.Collapse = &index.Collapse{Field: field, Count: params.Get("collapse_count") == "true"}
+		if n := params.Get("inner_hits"); n != "" {
+			if opts.Collapse.InnerHits, err = strconv.Atoi(n); err != nil {
+				return opts, errors.Errorf("invalid inner hits %s", n)
+			}
 		}
+	}
+	if fields := params.Get("highlight"); fields != "" {
+		opts.Highlight = &index.Highlight{Fields: strings.Split(fields, ","), PreTag: params.Get("pre_tag"),
+			PostTag: params.Get("post_tag"), Encoder: params.Get("encoder")}
+		if size := params.Get("fragment_size"); size != "" {
+			if opts.Highlight.FragmentSize, err = strconv.Atoi(size); err != nil {
+				return opts, errors.Errorf("invalid fragment size %s", size)
+			}
+		}
+		if n := params.Get("number_of_fragments"); n != "" {
+			if opts.Highlight.NumberOfFragments, err = strconv.Atoi(n); err != nil {
+				return opts, errors.Errorf("invalid number of fragments %s", n)
+			}
+		}
+	}
+	return opts, nil
+}
+
+// ValidateHandler checks syntax of a query without searching
+func (h *Handler) ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	err := h.Indexer.ValidateQuery(indexer, r.URL.Query().Get("query"))
+	if perr, ok := err.(*index.ParseError); ok {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseInvalidQuery(perr))
+		return
+	}
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	w.Write(responseOk("no data"))
+	w.Write(responseOk("valid query"))
+}
+
+// SearchDSLHandler searches by a JSON query DSL
+func (h *Handler) SearchDSLHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	var request index.SearchRequest
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "failed to read request body"))
+		return
+	}
+	if err = json.Unmarshal(body, &request); err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "failed to unmarshal request body"))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	hits, err := h.Indexer.SearchDSL(indexer, &request)
+	if perr, ok := errors.Cause(err).(*index.ParseError); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseInvalidQuery(perr))
+		return
+	}
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	if hits.Total == 0 {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseOk("no data"))
+		return
+	}
+	resp := Response{
+		Code:          "0",
+		Status:        "OK",
+		Docs:          hits.Docs,
+		Total:         hits.Total,
+		TotalRelation: hits.TotalRelation,
+		SearchAfter:   hits.SearchAfter,
+		Collapsed:     hits.Collapsed,
+		Highlights:    hits.Highlights,
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorln(err)
+		w.Write([]byte("{}"))
+		return
+	}
+	w.Write(data)
+}
+
+// ExplainHandler tells how a document matches the query
+func (h *Handler) ExplainHandler(w http.ResponseWriter, r *http.Request) {
+	// Dirty hack
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if h.Indexer == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseFailed("2", "please create indexer firstly"))
+		return
+	}
+	indexer := chi.URLParam(r, "indexer")
+	docid, err := strconv.ParseUint(chi.URLParam(r, "docid"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", "invalid docid"))
+		return
+	}
+	explanation, err := h.Indexer.Explain(indexer, r.URL.Query().Get("query"), docid)
+	if perr, ok := err.(*index.ParseError); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseInvalidQuery(perr))
+		return
+	}
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(responseFailed("1", err.Error()))
+		return
+	}
+	resp := Response{
+		Code:        "0",
+		Status:      "OK",
+		Explanation: explanation,
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorln(err)
+		w.Write([]byte("{}"))
+		return
+	}
+	w.Write(data)
+}
+
+// parseFields parses fields in form of "field1-type,field2-type-similarity", similarity of a string field is optional
+func parseFields(fields string) (map[string]uint64, []string, map[string]string, error) {
+	fieldsMeta := make(map[string]uint64, 0)
+	similarities := make(map[string]string)
+	var fieldsArr []string
+	for _, f := range strings.Split(fields, ",") {
+		fs := strings.Split(f, "-")
+		if len(fs) != 2 && len(fs) != 3 {
+			return nil, nil, nil, errors.Errorf("invalid field %s", f)
+		}
+		fs1, err := strconv.Atoi(fs[1])
+		if err != nil {
+			return nil, nil, nil, errors.Errorf("invalid type of field %s", f)
+		}
+		fieldsMeta[fs[0]] = uint64(fs1)
+		fieldsArr = append(fieldsArr, fs[0])
+		if len(fs) == 3 {
+			similarities[fs[0]] = fs[2]
+		}
+	}
+	return fieldsMeta, fieldsArr, similarities, nil
 }
 
 func responseFailed(code string, msg string) []byte {
@@ -129,6 +649,37 @@ func responseFailed(code string, msg string) []byte {
 	return data
 }
 
+// responseInvalidQuery tells an invalid query apart from a query without results
+func responseInvalidQuery(err *index.ParseError) []byte {
+	resp := Response{
+		Code:    "3",
+		Status:  "FAILED",
+		Message: "invalid query: " + err.Error(),
+		Error:   err,
+	}
+	data, e := json.Marshal(resp)
+	if e != nil {
+		log.Errorln(e)
+		return []byte("{}")
+	}
+	return data
+}
+
+func responseQueries(msg string, queries []string) []byte {
+	resp := Response{
+		Code:    "0",
+		Status:  "OK",
+		Message: msg,
+		Queries: queries,
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorln(err)
+		return []byte("{}")
+	}
+	return data
+}
+
 func responseOk(msg string) []byte {
 	resp := Response{
 		Code:    "0",
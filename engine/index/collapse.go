@@ -0,0 +1,69 @@
+package index
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Collapse keeps only the top doc of each distinct value of a keyword field, docs lacking the field aren't collapsed
+type Collapse struct {
+	Field string `json:"field"`
+	// Count counts docs collapsed into the top doc
+	Count bool `json:"count"`
+	// InnerHits is the number of collapsed docs to list after the top doc
+	InnerHits int `json:"inner_hits"`
+}
+
+// CollapsedHits are docs collapsed into a top doc of the value, empty for docs lacking the field
+type CollapsedHits struct {
+	Value string
+	Count int
+	Docs  []Doc
+}
+
+func (x *Index) checkCollapse(c *Collapse) error {
+	if c == nil {
+		return nil
+	}
+	field, ok := x.Fields[c.Field]
+	if !ok {
+		return errors.Errorf("field %s not found", c.Field)
+	}
+	if field.Type != TKeyword {
+		return errors.Errorf("field %s can't be collapsed, only keyword fields can", c.Field)
+	}
+	if c.InnerHits < 0 {
+		return errors.New("inner hits must not be negative")
+	}
+	return nil
+}
+
+// collapse keeps the first of sorted docs with each value of the field, and the docs collapsed into each of them
+func (x *Index) collapse(docs []Doc, c *Collapse) ([]Doc, []*CollapsedHits) {
+	field := x.Fields[c.Field]
+	var top []Doc
+	var collapsed []*CollapsedHits
+	groups := make(map[uint64]*CollapsedHits)
+	for _, doc := range docs {
+		ord, ok := field.sortValue(doc.DocID)
+		if !ok {
+			top = append(top, doc)
+			collapsed = append(collapsed, &CollapsedHits{})
+			continue
+		}
+		hits, ok := groups[ord]
+		if !ok {
+			hits = &CollapsedHits{Value: field.source.docValues.value(ord)}
+			groups[ord] = hits
+			top = append(top, doc)
+			collapsed = append(collapsed, hits)
+			continue
+		}
+		if c.Count {
+			hits.Count++
+		}
+		if len(hits.Docs) < c.InnerHits {
+			hits.Docs = append(hits.Docs, doc)
+		}
+	}
+	return top, collapsed
+}
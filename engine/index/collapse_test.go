@@ -0,0 +1,62 @@
+package index
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex_SearchWithOptions_Collapse(t *testing.T) {
+	index := newTestIndex(t, map[string]uint64{"text": TString, "author": TKeyword, "likes": TNumber},
+		map[string]string{"text": "super bowl", "author": "tom", "likes": "5"},
+		map[string]string{"text": "super bowl champion", "author": "nick", "likes": "3"},
+		map[string]string{"text": "super bowl party", "author": "tom", "likes": "9"},
+		map[string]string{"text": "super bowl", "likes": "7"},
+		map[string]string{"text": "super bowl movie", "author": "tom", "likes": "1"},
+		map[string]string{"text": "super bowl", "author": "nick", "likes": "2"},
+		map[string]string{"text": "super bowl"})
+	fields, err := ParseSort("likes:desc")
+	assert.Nil(t, err)
+	result, err := index.SearchWithOptions("super", SearchOptions{Sort: fields,
+		Collapse: &Collapse{Field: "author", Count: true, InnerHits: 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, 7, result.Total)
+	// docs lacking the field aren't collapsed
+	assert.Equal(t, []uint64{2, 3, 1, 6}, docIDs(result.Docs))
+	assert.Equal(t, 4, len(result.Collapsed))
+	assert.Equal(t, "tom", result.Collapsed[0].Value)
+	assert.Equal(t, 2, result.Collapsed[0].Count)
+	assert.Equal(t, []uint64{0}, docIDs(result.Collapsed[0].Docs))
+	assert.Equal(t, &CollapsedHits{}, result.Collapsed[1])
+	assert.Equal(t, "nick", result.Collapsed[2].Value)
+	assert.Equal(t, 1, result.Collapsed[2].Count)
+	assert.Equal(t, []uint64{5}, docIDs(result.Collapsed[2].Docs))
+
+	// collapsed hits are paged with their docs
+	result, err = index.SearchWithOptions("super", SearchOptions{Sort: fields, From: 1, Size: 2,
+		Collapse: &Collapse{Field: "author"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3, 1}, docIDs(result.Docs))
+	assert.Equal(t, []*CollapsedHits{{}, {Value: "nick"}}, result.Collapsed)
+	after := index.SortValues(result.Docs[0], fields)
+	result, err = index.SearchWithOptions("super", SearchOptions{Sort: fields, Size: 2, SearchAfter: after,
+		Collapse: &Collapse{Field: "author"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 6}, docIDs(result.Docs))
+	assert.Equal(t, 2, len(result.Collapsed))
+
+	var req SearchRequest
+	assert.Nil(t, json.Unmarshal([]byte(`{"query": {"match": {"text": "super"}}, "sort": [{"likes": "desc"}],
+		"size": 1, "collapse": {"field": "author", "inner_hits": 2}}`), &req))
+	result, err = index.SearchDSL(&req)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{2}, docIDs(result.Docs))
+	assert.Equal(t, []uint64{0, 4}, docIDs(result.Collapsed[0].Docs))
+	assert.Equal(t, 0, result.Collapsed[0].Count)
+
+	for _, c := range []*Collapse{{Field: "none"}, {Field: "likes"}, {Field: "text"}, {Field: "author", InnerHits: -1}} {
+		_, err = index.SearchWithOptions("super", SearchOptions{Collapse: c})
+		assert.NotNil(t, err, c)
+	}
+}
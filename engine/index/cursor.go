@@ -0,0 +1,171 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SortValues are values of a doc for keys of sorted docs followed by its docid, they locate the doc to search after
+// it. Keys are sort fields then score unless fields have it. A score is a float64, a docid, number or date is a uint64,
+// a keyword is a string and nil means the doc lacks the field, numbers decoded from JSON are json.Number.
+type SortValues []interface{}
+
+// UnmarshalJSON keeps numbers as json.Number so that large numbers aren't rounded
+func (v *SortValues) UnmarshalJSON(data []byte) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var values []interface{}
+	if err := d.Decode(&values); err != nil {
+		return errors.Errorf("invalid sort values %s", data)
+	}
+	*v = values
+	return nil
+}
+
+// ParseSortValues parses sort values in JSON, e.g. `[1549152000, "tom", 1.5, 3]`, empty text means no values
+func ParseSortValues(text string) (SortValues, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	var values SortValues
+	if err := json.Unmarshal([]byte(text), &values); err != nil {
+		return nil, errors.Errorf("invalid sort values %s", text)
+	}
+	return values, nil
+}
+
+// sortKeys returns keys docs are sorted by, docs having the same values of fields keep ranked by score
+func sortKeys(fields []SortField) []SortField {
+	for _, f := range fields {
+		if f.Field == SortScore {
+			return fields
+		}
+	}
+	return append(fields[:len(fields):len(fields)], SortField{Field: SortScore, Desc: true})
+}
+
+// SortValues returns values of doc to search after it in docs sorted by fields
+func (x *Index) SortValues(doc Doc, fields []SortField) SortValues {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	keys := sortKeys(fields)
+	values := make(SortValues, 0, len(keys)+1)
+	for _, f := range keys {
+		switch f.Field {
+		case SortScore:
+			values = append(values, doc.Score)
+		case SortDoc:
+			values = append(values, doc.DocID)
+		default:
+			field, ok := x.Fields[f.Field]
+			if !ok {
+				values = append(values, nil)
+				continue
+			}
+			v := x.sortValue(field, doc.DocID)
+			switch {
+			case v.missing:
+				values = append(values, nil)
+			case field.Type == TKeyword:
+				values = append(values, v.str)
+			default:
+				values = append(values, v.num)
+			}
+		}
+	}
+	return append(values, doc.DocID)
+}
+
+// sortValue returns value of field of doc, the value itself of keyword fields instead of its ordinal
+func (x *Index) sortValue(field *Field, docid uint64) sortValue {
+	num, ok := field.sortValue(docid)
+	if !ok {
+		return sortValue{missing: true}
+	}
+	if field.Type == TKeyword {
+		return sortValue{str: field.source.docValues.value(num)}
+	}
+	return sortValue{num: num}
+}
+
+// cursor is the position of a doc in sorted docs to search after
+type cursor struct {
+	keys   []SortField
+	values []sortValue
+	docid  uint64
+}
+
+// newCursor parses sort values of fields which are valid, nil if there are no values
+func (x *Index) newCursor(fields []SortField, after SortValues) (*cursor, error) {
+	if len(after) == 0 {
+		return nil, nil
+	}
+	keys := sortKeys(fields)
+	if len(after) != len(keys)+1 {
+		return nil, errors.Errorf("search after needs %d sort values and docid, got %d values", len(keys), len(after))
+	}
+	c := &cursor{keys: keys, values: make([]sortValue, len(keys))}
+	var err error
+	for i, f := range keys {
+		v := after[i]
+		switch {
+		case v == nil:
+			c.values[i].missing = true
+		case f.Field == SortScore:
+			c.values[i].score, err = strconv.ParseFloat(fmt.Sprint(v), 64)
+		case f.Field != SortDoc && x.Fields[f.Field].Type == TKeyword:
+			var ok bool
+			if c.values[i].str, ok = v.(string); !ok {
+				err = errors.Errorf("%v is not a string", v)
+			}
+		default:
+			c.values[i].num, err = parseSortNumber(v)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid sort value of %s", f.Field)
+		}
+	}
+	if c.docid, err = parseSortNumber(after[len(keys)]); err != nil {
+		return nil, errors.Wrap(err, "invalid docid of sort values")
+	}
+	return c, nil
+}
+
+// parseSortNumber parses a docid, number or date of sort values
+func parseSortNumber(v interface{}) (uint64, error) {
+	if f, ok := v.(float64); ok {
+		if f < 0 || f != float64(uint64(f)) {
+			return 0, errors.Errorf("invalid number %v", v)
+		}
+		return uint64(f), nil
+	}
+	n, err := strconv.ParseUint(fmt.Sprint(v), 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid number %v", v)
+	}
+	return n, nil
+}
+
+// follows tells if doc goes after the cursor in sorted docs
+func (c *cursor) follows(x *Index, doc Doc) bool {
+	for i, f := range c.keys {
+		var v sortValue
+		switch f.Field {
+		case SortScore:
+			v.score = doc.Score
+		case SortDoc:
+			v.num = doc.DocID
+		default:
+			v = x.sortValue(x.Fields[f.Field], doc.DocID)
+		}
+		if cmp := compareSortValues(v, c.values[i], f); cmp != 0 {
+			return cmp > 0
+		}
+	}
+	return doc.DocID > c.docid
+}
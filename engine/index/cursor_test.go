@@ -0,0 +1,76 @@
+package index
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSortValues(t *testing.T) {
+	values, err := ParseSortValues(`[1549152000, "tom", null, 1.5, 3]`)
+	assert.Nil(t, err)
+	assert.Equal(t, SortValues{json.Number("1549152000"), "tom", nil, json.Number("1.5"), json.Number("3")}, values)
+	values, err = ParseSortValues(" ")
+	assert.Nil(t, err)
+	assert.Nil(t, values)
+	_, err = ParseSortValues(`{"a": 1}`)
+	assert.NotNil(t, err)
+}
+
+func TestIndex_SearchAfter(t *testing.T) {
+	index := tweetsIndex(t)
+	for _, text := range []string{"", "created:desc", "created:desc:_first", "author", "author:desc:_first",
+		"_score:asc", "_doc:desc"} {
+		fields, err := ParseSort(text)
+		assert.Nil(t, err, text)
+		all, err := index.SearchWithOptions("super OR party", SearchOptions{Sort: fields})
+		assert.Nil(t, err, text)
+
+		// page by page after the last doc, with values passed in JSON
+		var docs []Doc
+		var after SortValues
+		for i := 0; i < len(all.Docs); i++ {
+			page, err := index.SearchWithOptions("super OR party", SearchOptions{Sort: fields, Size: 1, SearchAfter: after,
+				TrackTotalHits: true})
+			assert.Nil(t, err, text)
+			assert.Equal(t, len(all.Docs), page.Total, text)
+			if !assert.Equal(t, 1, len(page.Docs), text) {
+				break
+			}
+			docs = append(docs, page.Docs...)
+			data, err := json.Marshal(index.SortValues(page.Docs[0], fields))
+			assert.Nil(t, err, text)
+			assert.Nil(t, json.Unmarshal(data, &after), text)
+		}
+		assert.Equal(t, all.Docs, docs, text)
+		page, err := index.SearchWithOptions("super OR party", SearchOptions{Sort: fields, SearchAfter: after})
+		assert.Nil(t, err, text)
+		assert.Empty(t, page.Docs, text)
+	}
+
+	fields, _ := ParseSort("author")
+	sorted, err := index.SearchWithOptions("super", SearchOptions{Sort: fields})
+	assert.Nil(t, err)
+	assert.Equal(t, SortValues{"matt", sorted.Docs[0].Score, uint64(2)}, index.SortValues(sorted.Docs[0], fields))
+	assert.Equal(t, SortValues{nil, sorted.Docs[3].Score, uint64(3)}, index.SortValues(sorted.Docs[3], fields))
+	// a value between keywords of docs
+	result, err := index.SearchWithOptions("super", SearchOptions{Sort: fields, SearchAfter: SortValues{"n", 0.0, 0}})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 0, 3}, docIDs(result.Docs))
+
+	result, err = index.SearchWithOptions("super", SearchOptions{From: 1, Size: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{2, 1}, docIDs(result.Docs))
+	for _, opts := range []SearchOptions{
+		{Sort: fields, SearchAfter: SortValues{"matt", 0}},
+		{Sort: fields, SearchAfter: SortValues{1, 0.0, 0}},
+		{Sort: fields, SearchAfter: SortValues{"matt", "x", 0}},
+		{Sort: fields, SearchAfter: SortValues{"matt", 0.0, -1}},
+		{Sort: fields, SearchAfter: SortValues{"matt", 0.0, 0}, From: 1},
+		{From: -1},
+	} {
+		_, err = index.SearchWithOptions("super", opts)
+		assert.NotNil(t, err, opts)
+	}
+}
@@ -0,0 +1,59 @@
+package index
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dayLayout = "2006-01-02"
+)
+
+// dateLayouts are formats of date field, dates without time zone are in UTC
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", dayLayout}
+
+// isNumeric checks if values of field type are stored as uint64 and can be compared
+func isNumeric(ftype uint64) bool {
+	return ftype == TNumber || ftype == TDate
+}
+
+// parseNumeric parses value of number field, or date field into unix seconds
+func parseNumeric(ftype uint64, text string) (uint64, error) {
+	if ftype == TDate {
+		return parseDate(text)
+	}
+	return strconv.ParseUint(text, 10, 64)
+}
+
+// parseDate parses date in one of dateLayouts or unix seconds, dates before 1970 are not supported
+func parseDate(text string) (uint64, error) {
+	if sec, err := strconv.ParseUint(text, 10, 64); err == nil {
+		return sec, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			if t.Unix() < 0 {
+				return 0, errors.Errorf("date %s is before 1970", text)
+			}
+			return uint64(t.Unix()), nil
+		}
+	}
+	return 0, errors.Errorf("invalid date %s", text)
+}
+
+// formatDate formats unix seconds in RFC3339
+func formatDate(sec uint64) string {
+	return time.Unix(int64(sec), 0).UTC().Format(time.RFC3339)
+}
+
+// parseDay returns the first and the last second of a day like "2006-01-02"
+func parseDay(text string) (uint64, uint64, bool) {
+	t, err := time.Parse(dayLayout, text)
+	if err != nil || t.Unix() < 0 {
+		return 0, 0, false
+	}
+	start := uint64(t.Unix())
+	return start, start + 24*60*60 - 1, true
+}
@@ -0,0 +1,39 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	cases := []struct {
+		text string
+		sec  uint64
+	}{
+		{"1577836800", 1577836800},
+		{"2020-01-01", 1577836800},
+		{"2020-01-01 10:00:00", 1577872800},
+		{"2020-01-01T10:00:00", 1577872800},
+		{"2020-01-01T18:00:00+08:00", 1577872800},
+	}
+	for _, c := range cases {
+		sec, err := parseDate(c.text)
+		assert.Nil(t, err, c.text)
+		assert.Equal(t, c.sec, sec, c.text)
+	}
+	for _, text := range []string{"", "2020/01/01", "1969-12-31"} {
+		_, err := parseDate(text)
+		assert.NotNil(t, err, text)
+	}
+	assert.Equal(t, "2020-01-01T10:00:00Z", formatDate(1577872800))
+}
+
+func TestParseDay(t *testing.T) {
+	start, end, ok := parseDay("2020-01-01")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1577836800), start)
+	assert.Equal(t, uint64(1577923199), end)
+	_, _, ok = parseDay("2020-01-01 10:00:00")
+	assert.False(t, ok)
+}
@@ -0,0 +1,143 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SourceField stores the original json document
+	SourceField = "_source"
+)
+
+// FlattenJSON flattens nested json into dotted field names, arrays are marked by "[]" after their name,
+// e.g. {"user": {"name": "tom"}, "entities": {"hashtags": [{"text": "nfl"}]}} has fields
+// "user.name" and "entities.hashtags[].text", values of array elements are collected in order
+func FlattenJSON(data []byte) (map[string][]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "failed to decode json document")
+	}
+	flat := make(map[string][]string)
+	flattenValue("", doc, flat)
+	return flat, nil
+}
+
+func flattenValue(path string, value interface{}, flat map[string][]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// geo point in form of {"lat": 39.9, "lon": 116.4}
+		lat, latOK := v["lat"].(json.Number)
+		lon, lonOK := v["lon"].(json.Number)
+		if latOK && lonOK && path != "" {
+			flat[path] = append(flat[path], lat.String()+","+lon.String())
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if path == "" {
+				flattenValue(k, v[k], flat)
+			} else {
+				flattenValue(path+"."+k, v[k], flat)
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			flattenValue(path+"[]", e, flat)
+		}
+	case json.Number:
+		flat[path] = append(flat[path], v.String())
+	case string:
+		flat[path] = append(flat[path], v)
+	case bool:
+		if v {
+			flat[path] = append(flat[path], "true")
+		} else {
+			flat[path] = append(flat[path], "false")
+		}
+	default:
+		// null is missing
+	}
+}
+
+// AddJSONDocument flattens a json document into fields of index and stores the original document
+func (x *Index) AddJSONDocument(data []byte) error {
+	if x.FieldMeta == nil {
+		return errors.New("no field meta")
+	}
+	flat, err := FlattenJSON(data)
+	if err != nil {
+		return err
+	}
+	if _, ok := x.FieldMeta[SourceField]; !ok {
+		if err = x.AddFields(map[string]uint64{SourceField: TStore}); err != nil {
+			return errors.Wrap(err, "failed to add source field")
+		}
+	}
+	x.lock.RLock()
+	doc := x.flatDocument(flat)
+	x.lock.RUnlock()
+	buf := new(bytes.Buffer)
+	if err = json.Compact(buf, data); err != nil {
+		return errors.Wrap(err, "failed to compact json document")
+	}
+	doc[SourceField] = buf.String()
+	return x.AddDocument(doc)
+}
+
+// PercolateJSON returns ids of registered queries that the json document matches without adding it
+func (x *Index) PercolateJSON(data []byte) ([]string, error) {
+	flat, err := FlattenJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	return x.percolate(x.flatDocument(flat)), nil
+}
+
+// flatDocument returns values of fields in flattened json document
+func (x *Index) flatDocument(flat map[string][]string) map[string]string {
+	doc := make(map[string]string, len(x.FieldMeta))
+	for fname, ftype := range x.FieldMeta {
+		values, ok := flat[fname]
+		if !ok || fname == SourceField {
+			continue
+		}
+		// text of multiple values are joined, others only keep the first value
+		if ftype == TString || ftype == TStore {
+			doc[fname] = strings.Join(values, " ")
+		} else {
+			doc[fname] = values[0]
+		}
+	}
+	return doc
+}
+
+// GetSource returns the original json document
+func (x *Index) GetSource(docid uint64) (map[string]interface{}, bool) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	field, ok := x.Fields[SourceField]
+	if !ok {
+		return nil, false
+	}
+	v, _, ok, err := field.getDetail(docid)
+	if err != nil || !ok {
+		return nil, false
+	}
+	var source map[string]interface{}
+	if err = json.Unmarshal([]byte(v), &source); err != nil {
+		return nil, false
+	}
+	return source, true
+}
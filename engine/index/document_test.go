@@ -0,0 +1,79 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenJSON(t *testing.T) {
+	flat, err := FlattenJSON([]byte(`{
+		"text": "Patriots win",
+		"retweets": 1024,
+		"sensitive": false,
+		"reply": null,
+		"user": {"name": "tom", "location": {"lat": 42.09, "lon": -71.26}},
+		"entities": {"hashtags": [{"text": "nfl"}, {"text": "superbowl"}], "symbols": ["$NFL"]}
+	}`))
+	assert.Nil(t, err)
+	expected := map[string][]string{
+		"text":                     {"Patriots win"},
+		"retweets":                 {"1024"},
+		"sensitive":                {"false"},
+		"user.name":                {"tom"},
+		"user.location":            {"42.09,-71.26"},
+		"user.location.lat":        {"42.09"},
+		"user.location.lon":        {"-71.26"},
+		"entities.hashtags[].text": {"nfl", "superbowl"},
+		"entities.symbols[]":       {"$NFL"},
+	}
+	assert.Equal(t, expected, flat)
+
+	_, err = FlattenJSON([]byte(`["not", "object"]`))
+	assert.NotNil(t, err)
+}
+
+func TestIndex_AddJSONDocument_GetSource(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	err = index.IndexFields(map[string]uint64{
+		"text":                     TString,
+		"retweets":                 TNumber,
+		"user.name":                TString,
+		"entities.hashtags[].text": TString,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, index.AddDocument(map[string]string{"text": "plain document"}))
+	err = index.AddJSONDocument([]byte(`{"text": "Patriots win", "retweets": 1024, "user": {"name": "tom"},
+		"entities": {"hashtags": [{"text": "nfl"}, {"text": "superbowl"}]}}`))
+	assert.Nil(t, err)
+	err = index.AddJSONDocument([]byte(`{"text": "Falcons lose", "user": {"name": "matt"}}`))
+	assert.Nil(t, err)
+	assert.NotNil(t, index.AddJSONDocument([]byte(`{"text":`)))
+	assert.Nil(t, index.SyncToDisk())
+
+	docs1, found1 := index.Search("entities.hashtags[].text:superbowl")
+	assert.True(t, found1)
+	assert.Equal(t, []uint64{1}, docIDs(docs1))
+	docs2, found2 := index.Search("user.name:matt")
+	assert.True(t, found2)
+	assert.Equal(t, []uint64{2}, docIDs(docs2))
+
+	doc1, ok := index.GetDocument(1)
+	assert.True(t, ok)
+	assert.Equal(t, "nfl superbowl", doc1["entities.hashtags[].text"])
+	assert.Equal(t, "1024", doc1["retweets"])
+	assert.Equal(t, `{"text":"Patriots win","retweets":1024,"user":{"name":"tom"},"entities":{"hashtags":[{"text":"nfl"},{"text":"superbowl"}]}}`, doc1[SourceField])
+	source, ok := index.GetSource(1)
+	assert.True(t, ok)
+	assert.Equal(t, "tom", source["user"].(map[string]interface{})["name"])
+	_, ok = index.GetSource(0)
+	assert.False(t, ok)
+	doc0, ok := index.GetDocument(0)
+	assert.True(t, ok)
+	_, ok = doc0[SourceField]
+	assert.False(t, ok)
+}
@@ -0,0 +1,142 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/cosmtrek/violet/pkg/skeleton"
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// docValues are values of a keyword field in column, each doc has the ordinal of its value in sorted distinct values,
+// so docs are sorted by comparing ordinals without reading stored strings
+type docValues struct {
+	// ords are ordinals plus 1 by docid, 0 if the doc has no value
+	ords   *skeleton.Norms
+	values []string
+	// pending are values of docs added since ordinals were built
+	pending map[uint64]string
+	sync.Mutex
+}
+
+func newDocValues() *docValues {
+	return &docValues{
+		ords:    skeleton.NewNorms(),
+		pending: make(map[uint64]string),
+	}
+}
+
+// add records value of doc, ordinals are built when they are read
+func (d *docValues) add(docid uint64, value string) {
+	d.Lock()
+	defer d.Unlock()
+	d.pending[docid] = value
+}
+
+// build merges pending values into sorted values and renumbers ordinals of all docs
+func (d *docValues) build() {
+	if len(d.pending) == 0 {
+		return
+	}
+	found := make(map[string]bool, len(d.values)+len(d.pending))
+	values := make([]string, 0, len(d.values)+len(d.pending))
+	for _, v := range d.values {
+		found[v] = true
+		values = append(values, v)
+	}
+	for _, v := range d.pending {
+		if !found[v] {
+			found[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	ordinals := make(map[string]uint32, len(values))
+	for i, v := range values {
+		ordinals[v] = uint32(i + 1)
+	}
+	for docid := uint64(0); docid < d.ords.Len(); docid++ {
+		if ord := d.ords.Get(docid); ord > 0 {
+			d.ords.Set(docid, ordinals[d.values[ord-1]])
+		}
+	}
+	for docid, v := range d.pending {
+		d.ords.Set(docid, ordinals[v])
+	}
+	d.values = values
+	d.pending = make(map[uint64]string)
+}
+
+// ord returns ordinal of value of doc, false if the doc has no value
+func (d *docValues) ord(docid uint64) (uint64, bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.build()
+	ord := d.ords.Get(docid)
+	return uint64(ord) - 1, ord > 0
+}
+
+// lookup returns ordinal of value, false if no doc has the value
+func (d *docValues) lookup(value string) (uint64, bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.build()
+	i := sort.SearchStrings(d.values, value)
+	return uint64(i), i < len(d.values) && d.values[i] == value
+}
+
+// value returns value of ordinal
+func (d *docValues) value(ord uint64) string {
+	d.Lock()
+	defer d.Unlock()
+	d.build()
+	if ord >= uint64(len(d.values)) {
+		return ""
+	}
+	return d.values[ord]
+}
+
+// load reads ordinals and values from files
+func (d *docValues) load(filepath, field string) error {
+	d.Lock()
+	defer d.Unlock()
+	if !utils.FileExists(docValuesFile(filepath, field)) {
+		return nil
+	}
+	if err := d.ords.Load(docValuesFile(filepath, field)); err != nil {
+		return errors.Wrap(err, "failed to load ordinals")
+	}
+	data, err := utils.ReadJSON(docValuesTermsFile(filepath, field))
+	if err != nil {
+		return errors.Wrap(err, "failed to read values")
+	}
+	if err = json.Unmarshal(data, &d.values); err != nil {
+		return errors.Wrap(err, "failed to unmarshal values")
+	}
+	return nil
+}
+
+// save builds ordinals and persists them with values into files
+func (d *docValues) save(filepath, field string) error {
+	d.Lock()
+	defer d.Unlock()
+	d.build()
+	if err := d.ords.Save(docValuesFile(filepath, field)); err != nil {
+		return errors.Wrap(err, "failed to save ordinals")
+	}
+	if err := utils.WriteJSON(docValuesTermsFile(filepath, field), d.values); err != nil {
+		return errors.Wrap(err, "failed to write values")
+	}
+	return nil
+}
+
+func docValuesFile(filepath, field string) string {
+	return fmt.Sprintf("%v%v.dv", filepath, field)
+}
+
+func docValuesTermsFile(filepath, field string) string {
+	return fmt.Sprintf("%v%v.dvterms", filepath, field)
+}
@@ -0,0 +1,71 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocValues(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	dv := newDocValues()
+	dv.add(0, "tom")
+	dv.add(2, "matt")
+	dv.add(3, "tom")
+	ord, ok := dv.ord(0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), ord)
+	_, ok = dv.ord(1)
+	assert.False(t, ok)
+
+	// ordinals are renumbered for new values
+	dv.add(4, "nick")
+	ord, _ = dv.ord(0)
+	assert.Equal(t, uint64(2), ord)
+	ord, _ = dv.ord(4)
+	assert.Equal(t, uint64(1), ord)
+	assert.Equal(t, "nick", dv.value(1))
+	ord, ok = dv.lookup("tom")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), ord)
+	_, ok = dv.lookup("brady")
+	assert.False(t, ok)
+
+	assert.Nil(t, dv.save(path+"/", "author"))
+	loaded := newDocValues()
+	assert.Nil(t, loaded.load(path+"/", "author"))
+	ord, ok = loaded.ord(3)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), ord)
+	assert.Equal(t, []string{"matt", "nick", "tom"}, loaded.values)
+}
+
+func TestIndex_KeywordField(t *testing.T) {
+	index := tweetsIndex(t)
+	cases := []struct {
+		query    string
+		expected []uint64
+	}{
+		{"author:tom", []uint64{0}},
+		{`author:"nick foles"`, []uint64{1}},
+		{"author:nick", nil},
+		{"super -author:tom", []uint64{2, 1, 3}},
+		{"bowl author:matt", []uint64{2}},
+	}
+	for _, c := range cases {
+		docs, err := index.SearchQuery(c.query)
+		assert.Nil(t, err, c.query)
+		assert.Equal(t, c.expected, docIDs(docs), c.query)
+	}
+	doc, ok := index.GetDocument(1)
+	assert.True(t, ok)
+	assert.Equal(t, "nick foles", doc["author"])
+	assert.True(t, (&keywordQuery{field: "author", value: "matt"}).match(index, 2))
+	assert.False(t, (&keywordQuery{field: "author", value: "matt"}).match(index, 3))
+
+	assert.Nil(t, index.Percolator().Register("matt", "author:matt"))
+	assert.Equal(t, []string{"matt"}, index.Percolate(map[string]string{"author": "matt"}))
+	assert.Nil(t, index.Percolate(map[string]string{"author": "matt ryan"}))
+}
@@ -0,0 +1,423 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSearchSize is the number of docs returned by a search request without size
+	DefaultSearchSize = 10
+)
+
+// SearchRequest is a structured search, query is a clause of JSON query DSL, e.g.
+// {"bool": {"must": [{"match": {"title": "tom brady"}}], "filter": [{"range": {"age": {"gte": 30}}}]}}
+type SearchRequest struct {
+	Query  json.RawMessage `json:"query"`
+	From   int             `json:"from"`
+	Size   *int            `json:"size"`
+	Sort   []SortField     `json:"sort"`
+	Fields []string        `json:"fields"`
+	// SearchAfter returns docs after the doc of the sort values instead of skipping from docs
+	SearchAfter SortValues `json:"search_after"`
+	// TrackTotalHits counts all matched docs instead of skipping the ones that can't rank in the page
+	TrackTotalHits bool `json:"track_total_hits"`
+	// Collapse keeps the top doc of each value of a keyword field, e.g. {"field": "author", "inner_hits": 3}
+	Collapse *Collapse `json:"collapse"`
+	// Highlight marks matched terms in fragments of string fields, e.g. {"fields": ["text"], "fragment_size": 50}
+	Highlight *Highlight `json:"highlight"`
+}
+
+// SearchResult is a page of docs matching a search request, total relation tells if total is exact or a lower bound,
+// collapsed are docs collapsed into each doc of the page if docs are collapsed, highlights are highlighted fragments of
+// fields of each doc of the page if asked
+type SearchResult struct {
+	Total         int
+	TotalRelation string
+	Docs          []Doc
+	Collapsed     []*CollapsedHits
+	Highlights    []map[string][]string
+}
+
+// SearchDSL searches docs by a structured request
+func (x *Index) SearchDSL(req *SearchRequest) (*SearchResult, error) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	root, err := x.compileDSL(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	size := DefaultSearchSize
+	if req.Size != nil {
+		if *req.Size < 0 {
+			return nil, errors.New("size must not be negative")
+		}
+		size = *req.Size
+	}
+	return x.searchNode(root, SearchOptions{Sort: req.Sort, From: req.From, Size: size, SearchAfter: req.SearchAfter,
+		TrackTotalHits: req.TrackTotalHits, Collapse: req.Collapse, Highlight: req.Highlight})
+}
+
+// CompileDSL compiles a clause of JSON query DSL into query syntax tree, empty clause matches all docs
+func (x *Index) CompileDSL(clause json.RawMessage) (Node, error) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	return x.compileDSL(clause)
+}
+
+func (x *Index) compileDSL(clause json.RawMessage) (Node, error) {
+	if len(bytes.TrimSpace(clause)) == 0 || bytes.Equal(bytes.TrimSpace(clause), []byte("null")) {
+		return &matchAllQuery{}, nil
+	}
+	p := &parser{index: x, defaultOp: x.DefaultOperator}
+	if p.defaultOp != OperatorOr {
+		p.defaultOp = OperatorAnd
+	}
+	return p.compileClause(clause)
+}
+
+func (p *parser) compileClause(clause json.RawMessage) (Node, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(clause, &typed); err != nil || len(typed) != 1 {
+		return nil, errors.Errorf("clause %s must be an object with one type", clause)
+	}
+	for typ, body := range typed {
+		switch typ {
+		case "match_all":
+			return &matchAllQuery{}, nil
+		case "query_string":
+			var params struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal(body, &params); err != nil {
+				return nil, errors.Wrap(err, "invalid query_string")
+			}
+			return parseQuery(p.index, params.Query, p.defaultOp)
+		case "match":
+			return p.compileMatch(body)
+		case "multi_match":
+			return p.compileMultiMatch(body)
+		case "phrase", "match_phrase":
+			return p.compilePhrase(body)
+		case "term":
+			return p.compileTerm(body)
+		case "range":
+			return p.compileRange(body)
+		case "exists":
+			var params struct {
+				Field string `json:"field"`
+			}
+			if err := json.Unmarshal(body, &params); err != nil {
+				return nil, errors.Wrap(err, "invalid exists")
+			}
+			return &existsQuery{field: params.Field}, nil
+		case "bool":
+			return p.compileBool(body)
+		case "function_score":
+			return p.compileFunctionScore(body)
+		default:
+			return nil, errors.Errorf("unknown clause %s", typ)
+		}
+	}
+	return nil, nil
+}
+
+// matchParams is {"field": "text"} or {"field": {"query": "text", "operator": "or", "slop": 1, "boost": 2}}
+type matchParams struct {
+	Query    string
+	Operator string
+	Slop     *int
+	Boost    *float64
+}
+
+// boost multiplies scores of node by boost of params if there is
+func (m matchParams) boost(node Node, err error) (Node, error) {
+	if err != nil || m.Boost == nil {
+		return node, err
+	}
+	if *m.Boost < 0 {
+		return nil, errors.Errorf("invalid boost %v", *m.Boost)
+	}
+	return newBoostQuery(node, *m.Boost), nil
+}
+
+// fieldParams returns the only field of body and its params
+func (p *parser) fieldParams(typ string, body json.RawMessage) (string, matchParams, error) {
+	var fields map[string]json.RawMessage
+	var params matchParams
+	if err := json.Unmarshal(body, &fields); err != nil || len(fields) != 1 {
+		return "", params, errors.Errorf("%s must have one field", typ)
+	}
+	for field, raw := range fields {
+		if _, ok := p.index.FieldMeta[field]; !ok {
+			return "", params, errors.Errorf("unknown field %s", field)
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			var object struct {
+				Query    json.RawMessage `json:"query"`
+				Operator string          `json:"operator"`
+				Slop     *int            `json:"slop"`
+				Boost    *float64        `json:"boost"`
+			}
+			if err := json.Unmarshal(raw, &object); err != nil {
+				return "", params, errors.Wrapf(err, "invalid %s of field %s", typ, field)
+			}
+			raw = object.Query
+			params.Operator, params.Slop, params.Boost = strings.ToUpper(object.Operator), object.Slop, object.Boost
+		}
+		query, err := rawString(raw)
+		if err != nil {
+			return "", params, errors.Wrapf(err, "invalid %s of field %s", typ, field)
+		}
+		params.Query = query
+		return field, params, nil
+	}
+	return "", params, nil
+}
+
+// compileMatch analyzes text of string field, other fields match text as in query string
+func (p *parser) compileMatch(body json.RawMessage) (Node, error) {
+	field, params, err := p.fieldParams("match", body)
+	if err != nil {
+		return nil, err
+	}
+	if p.index.FieldMeta[field] != TString {
+		return params.boost(p.fieldClause(field, params.Query, token{text: params.Query}))
+	}
+	return params.boost(p.matchTerms(params.Query, params.Operator, func(text string) Node {
+		return p.termClause(field, text)
+	}), nil)
+}
+
+// matchTerms requires all terms of text by default, or any of them if operator is "or"
+func (p *parser) matchTerms(text, operator string, clause func(string) Node) Node {
+	op := p.defaultOp
+	if operator != "" {
+		op = operator
+	}
+	if op != OperatorOr {
+		return clause(text)
+	}
+	var children []Node
+	for _, term := range p.index.Segmenter.Analyze(text, false) {
+		children = appendNode(children, clause(term))
+	}
+	return newBoolQuery(OperatorOr, children)
+}
+
+// compileMultiMatch compiles {"query": "text", "fields": ["title^3", "text"], "type": "best_fields"},
+// which searches default fields of index if fields are empty
+func (p *parser) compileMultiMatch(body json.RawMessage) (Node, error) {
+	var params struct {
+		Query    json.RawMessage `json:"query"`
+		Fields   []string        `json:"fields"`
+		Type     string          `json:"type"`
+		Operator string          `json:"operator"`
+		Boost    *float64        `json:"boost"`
+	}
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil, errors.Wrap(err, "invalid multi_match")
+	}
+	query, err := rawString(params.Query)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid query of multi_match")
+	}
+	if params.Type != "" && params.Type != ModeCrossFields && params.Type != ModeBestFields {
+		return nil, errors.Errorf("invalid type %s of multi_match", params.Type)
+	}
+	for _, f := range params.Fields {
+		name, boost, ok := splitBoost(f)
+		if (!ok && strings.Contains(f, "^")) || boost < 0 {
+			return nil, errors.Errorf("invalid boost of field %s", f)
+		}
+		if p.index.FieldMeta[name] != TString {
+			return nil, errors.Errorf("field %s is not a string field", name)
+		}
+	}
+	node := p.matchTerms(query, strings.ToUpper(params.Operator), func(text string) Node {
+		if term, ok := p.termClause("", text).(*termQuery); ok {
+			term.fields, term.mode = params.Fields, params.Type
+			return term
+		}
+		return nil
+	})
+	return matchParams{Boost: params.Boost}.boost(node, nil)
+}
+
+func (p *parser) compilePhrase(body json.RawMessage) (Node, error) {
+	field, params, err := p.fieldParams("phrase", body)
+	if err != nil {
+		return nil, err
+	}
+	if p.index.FieldMeta[field] != TString {
+		return nil, errors.Errorf("field %s is not a string field", field)
+	}
+	if params.Slop != nil {
+		if *params.Slop < 0 {
+			return nil, errors.Errorf("invalid slop %d", *params.Slop)
+		}
+		return params.boost(p.phrase(field, params.Query, *params.Slop, true), nil)
+	}
+	return params.boost(p.phrase(field, params.Query, 0, false), nil)
+}
+
+// compileTerm matches exact term of string field without analyzing it
+func (p *parser) compileTerm(body json.RawMessage) (Node, error) {
+	field, params, err := p.fieldParams("term", body)
+	if err != nil {
+		return nil, err
+	}
+	if p.index.FieldMeta[field] != TString {
+		return params.boost(p.fieldClause(field, params.Query, token{text: params.Query}))
+	}
+	return params.boost(&termQuery{field: field, text: params.Query, terms: []string{params.Query}}, nil)
+}
+
+// compileRange compiles {"field": {"gt": a, "gte": a, "lt": b, "lte": b}} of number or date field
+func (p *parser) compileRange(body json.RawMessage) (Node, error) {
+	var fields map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || len(fields) != 1 {
+		return nil, errors.New("range must have one field")
+	}
+	operators := map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+	var nodes []Node
+	for field, bounds := range fields {
+		if !isNumeric(p.index.FieldMeta[field]) {
+			return nil, errors.Errorf("field %s is not a number or date field", field)
+		}
+		// keep order of bounds stable
+		keys := make([]string, 0, len(bounds))
+		for key := range bounds {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			operator, ok := operators[key]
+			if !ok {
+				return nil, errors.Errorf("unknown range bound %s", key)
+			}
+			value, err := rawString(bounds[key])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid range bound %s", key)
+			}
+			node, err := p.compareClause(field, operator, value, token{text: value})
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		}
+		if len(nodes) == 0 {
+			return &existsQuery{field: field}, nil
+		}
+	}
+	return newBoolQuery(OperatorAnd, nodes), nil
+}
+
+// compileBool combines must, filter and must_not clauses, should clauses are required only if there are no
+// must or filter clauses, otherwise docs matching them score higher
+func (p *parser) compileBool(body json.RawMessage) (Node, error) {
+	var params struct {
+		Must    clauseList `json:"must"`
+		Should  clauseList `json:"should"`
+		MustNot clauseList `json:"must_not"`
+		Filter  clauseList `json:"filter"`
+	}
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil, errors.Wrap(err, "invalid bool")
+	}
+	// clauses matching nothing, e.g. empty ones, are dropped, and counted by the second return value
+	compile := func(clauses clauseList, wrap func(Node) Node) ([]Node, int, error) {
+		var nodes []Node
+		nothing := 0
+		for _, clause := range clauses {
+			node, err := p.compileClause(clause)
+			if err != nil {
+				return nil, 0, err
+			}
+			if node == nil {
+				nothing++
+				continue
+			}
+			nodes = append(nodes, wrap(node))
+		}
+		return nodes, nothing, nil
+	}
+	same := func(n Node) Node { return n }
+	must, mustNothing, err := compile(params.Must, same)
+	if err != nil {
+		return nil, err
+	}
+	filter, filterNothing, err := compile(params.Filter, func(n Node) Node { return &constantScoreQuery{child: n} })
+	if err != nil {
+		return nil, err
+	}
+	mustNot, _, err := compile(params.MustNot, func(n Node) Node { return &notQuery{child: n} })
+	if err != nil {
+		return nil, err
+	}
+	should, shouldNothing, err := compile(params.Should, same)
+	if err != nil {
+		return nil, err
+	}
+
+	// a required clause matching nothing makes the bool match nothing, so does should matching nothing alone
+	if mustNothing+filterNothing > 0 {
+		return nil, nil
+	}
+	required := append(append(must, filter...), mustNot...)
+	if len(must)+len(filter) == 0 {
+		if len(should) > 0 {
+			required = append(required, newBoolQuery(OperatorOr, should))
+		} else if shouldNothing > 0 {
+			return nil, nil
+		}
+		if len(required) == 0 {
+			return &matchAllQuery{}, nil
+		}
+		return newBoolQuery(OperatorAnd, required), nil
+	}
+	node := newBoolQuery(OperatorAnd, required)
+	if len(should) > 0 {
+		return &optionalQuery{required: node, optional: should}, nil
+	}
+	return node, nil
+}
+
+// clauseList is an array of clauses or a single clause
+type clauseList []json.RawMessage
+
+func (c *clauseList) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var clauses []json.RawMessage
+		if err := json.Unmarshal(data, &clauses); err != nil {
+			return err
+		}
+		*c = clauses
+		return nil
+	}
+	*c = clauseList{json.RawMessage(data)}
+	return nil
+}
+
+// rawString returns string of a JSON string, number or bool
+func rawString(raw json.RawMessage) (string, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number, bool:
+		return fmt.Sprintf("%v", v), nil
+	default:
+		return "", errors.Errorf("%s is not a string or number", raw)
+	}
+}
@@ -0,0 +1,87 @@
+package index
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex_SearchDSL(t *testing.T) {
+	index := mockedIndex(t)
+	cases := []struct {
+		request  string
+		expected []uint64
+		total    int
+	}{
+		{`{}`, []uint64{0, 1, 2, 3}, 4},
+		{`{"query": {"match": {"a": "tom brady"}}}`, []uint64{0}, 1},
+		{`{"query": {"match": {"a": {"query": "tom brady", "operator": "or"}}}}`, []uint64{0, 2, 3}, 3},
+		{`{"query": {"phrase": {"a": "super bowl"}}}`, []uint64{0, 1}, 2},
+		{`{"query": {"match_phrase": {"a": {"query": "bowl tom", "slop": 2}}}}`, []uint64{0}, 1},
+		{`{"query": {"term": {"a": "movie"}}}`, []uint64{2, 3}, 2},
+		{`{"query": {"term": {"b": 60}}}`, []uint64{2}, 1},
+		{`{"query": {"range": {"b": {"gte": 31, "lt": 60}}}}`, []uint64{0, 1}, 2},
+		{`{"query": {"exists": {"field": "b"}}}`, []uint64{0, 1, 2}, 3},
+		{`{"query": {"query_string": {"query": "tom -movie"}}}`, []uint64{0}, 1},
+		{`{"query": {"bool": {"must": {"match": {"a": "movie"}}, "must_not": [{"match": {"a": "tom"}}]}}}`, []uint64{3}, 1},
+		{`{"query": {"bool": {"should": [{"match": {"a": "matt"}}, {"match": {"a": "hanks"}}]}}}`, []uint64{2, 1}, 2},
+		{`{"query": {"bool": {"filter": [{"range": {"b": {"gt": 30}}}], "should": [{"phrase": {"a": "tom hanks"}}]}}}`,
+			[]uint64{2, 0, 1}, 3},
+		{`{"query": {"bool": {"must_not": {"exists": {"field": "b"}}}}}`, []uint64{3}, 1},
+		{`{"query": {"bool": {"must": [{"match": {"a": "  "}}]}}}`, nil, 0},
+		{`{"query": {"bool": {"must": [{"match": {"a": "tom"}}, {"match": {"a": ""}}]}}}`, nil, 0},
+		{`{"query": {"bool": {"filter": {"match": {"a": " "}}, "should": [{"match": {"a": "tom"}}]}}}`, nil, 0},
+		{`{"query": {"bool": {"should": [{"match": {"a": "  "}}]}}}`, nil, 0},
+		{`{"query": {"bool": {"must": {"term": {"a": "movie"}}, "must_not": {"match": {"a": " "}}}}}`, []uint64{2, 3}, 2},
+		{`{"query": {"bool": {"should": [{"match": {"a": "tom"}}, {"match": {"a": {"query": "brady", "boost": 3}}}]}}}`,
+			[]uint64{0, 3, 2}, 3},
+		{`{"query": {"multi_match": {"query": "tom movie", "fields": ["a^2"]}}}`, []uint64{2}, 1},
+		{`{"query": {"multi_match": {"query": "matt hanks", "operator": "or", "type": "best_fields"}}}`, []uint64{2, 1}, 2},
+		{`{"query": {"match_all": {}}, "from": 1, "size": 2}`, []uint64{1, 2}, 4},
+		{`{"query": {"match_all": {}}, "from": 5}`, nil, 4},
+		{`{"sort": [{"b": "desc"}]}`, []uint64{2, 0, 1, 3}, 4},
+		{`{"sort": [{"b": {"order": "asc"}}], "size": 3}`, []uint64{1, 0, 2}, 4},
+		{`{"sort": ["_score", {"_doc": "desc"}]}`, []uint64{3, 2, 1, 0}, 4},
+	}
+	for _, c := range cases {
+		var req SearchRequest
+		assert.Nil(t, json.Unmarshal([]byte(c.request), &req), c.request)
+		result, err := index.SearchDSL(&req)
+		assert.Nil(t, err, c.request)
+		var actual []uint64
+		for _, doc := range result.Docs {
+			actual = append(actual, doc.DocID)
+		}
+		assert.Equal(t, c.expected, actual, c.request)
+		assert.Equal(t, c.total, result.Total, c.request)
+	}
+}
+
+func TestIndex_SearchDSL_Invalid(t *testing.T) {
+	index := mockedIndex(t)
+	for _, request := range []string{
+		`{"query": {"unknown": {}}}`,
+		`{"query": {"match": {"x": "tom"}}}`,
+		`{"query": {"match": {"a": "tom", "b": "1"}}}`,
+		`{"query": {"range": {"a": {"gt": 1}}}}`,
+		`{"query": {"range": {"b": {"gt": "x"}}}}`,
+		`{"query": {"bool": {"must": [{"nothing": {}}]}}}`,
+		`{"query": {"bool": {"must": [{}]}}}`,
+		`{"query": {"query_string": {"query": "(tom"}}}`,
+		`{"query": {"multi_match": {"query": "tom", "fields": ["b"]}}}`,
+		`{"query": {"multi_match": {"query": "tom", "type": "most_fields"}}}`,
+		`{"query": {"match": {"a": {"query": "tom", "boost": -1}}}}`,
+		`{"sort": [{"a": "asc"}]}`,
+		`{"from": -1}`,
+	} {
+		var req SearchRequest
+		err := json.Unmarshal([]byte(request), &req)
+		if err == nil {
+			_, err = index.SearchDSL(&req)
+		}
+		assert.NotNil(t, err, request)
+	}
+	var req SearchRequest
+	assert.NotNil(t, json.Unmarshal([]byte(`{"sort": [{"b": "up"}]}`), &req))
+}
@@ -0,0 +1,319 @@
+package index
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxExpansions limits terms a wildcard or fuzzy query expands to
+	DefaultMaxExpansions = 1024
+	// MaxFuzzyDistance is the max edit distance of fuzzy queries
+	MaxFuzzyDistance = 2
+)
+
+// expandTerms returns terms of field that start with prefix and match, it stops after limit terms
+// and reports if there are more
+func (f *Field) expandTerms(prefix string, match func(term string) bool, limit int) ([]string, bool) {
+	if f.invert == nil {
+		return nil, false
+	}
+	var terms []string
+	more := false
+	f.invert.terms.Prefix(prefix, func(term string, _ uint64) bool {
+		if !match(term) {
+			return true
+		}
+		if len(terms) >= limit {
+			more = true
+			return false
+		}
+		terms = append(terms, term)
+		return true
+	})
+	return terms, more
+}
+
+// expandFields expands terms in the string field, or all string fields if field is empty
+func (x *Index) expandFields(field, prefix string, match func(term string) bool) (map[string][]string, error) {
+	limit := x.MaxExpansions
+	if limit <= 0 {
+		limit = DefaultMaxExpansions
+	}
+	expansions := make(map[string][]string)
+	total := 0
+	for _, name := range textFields(x, field) {
+		f, ok := x.Fields[name]
+		if !ok {
+			continue
+		}
+		terms, more := f.expandTerms(prefix, match, limit-total)
+		total += len(terms)
+		if more {
+			return nil, errors.Errorf("more than %d terms matched", limit)
+		}
+		if len(terms) > 0 {
+			expansions[name] = terms
+		}
+	}
+	return expansions, nil
+}
+
+// fuzzyTerms returns terms of field within distance of word, it stops after limit terms and reports if there are more
+func (f *Field) fuzzyTerms(word string, distance int, limit int) (map[string]int, bool) {
+	if f.invert == nil {
+		return nil, false
+	}
+	dict := f.invert.terms
+	automaton := newLevenshteinAutomaton(word, distance)
+	terms := make(map[string]int)
+	// rows[i] is the state after reading i runes of runes, which is shared by terms with the same prefix
+	rows := [][]int{automaton.start()}
+	var runes []rune
+	n := dict.Len()
+	for i := 0; i < n; {
+		term, _ := dict.Term(i)
+		termRunes := []rune(term)
+		common := 0
+		for common < len(runes) && common < len(termRunes) && runes[common] == termRunes[common] {
+			common++
+		}
+		rows, runes = rows[:common+1], runes[:common]
+		dead := false
+		for j := common; j < len(termRunes); j++ {
+			var prev2 []int
+			var prevRune rune
+			if j > 0 {
+				prev2, prevRune = rows[j-1], termRunes[j-1]
+			}
+			row := automaton.step(prev2, rows[j], prevRune, termRunes[j])
+			rows, runes = append(rows, row), append(runes, termRunes[j])
+			if !automaton.canMatch(row) {
+				dead = true
+				break
+			}
+		}
+		if dead {
+			// no term starting with runes can match, skip all of them
+			next, ok := nextPrefix(string(runes))
+			if !ok {
+				break
+			}
+			i = dict.Seek(next)
+			continue
+		}
+		if d := automaton.distance(rows[len(rows)-1]); d <= distance {
+			if len(terms) >= limit {
+				return terms, true
+			}
+			terms[term] = d
+		}
+		i++
+	}
+	return terms, false
+}
+
+// fuzzyFields expands terms within distance of word in the string field, or all string fields if field is empty
+func (x *Index) fuzzyFields(field, word string, distance int) (map[string][]string, map[string]float64, error) {
+	limit := x.MaxExpansions
+	if limit <= 0 {
+		limit = DefaultMaxExpansions
+	}
+	expansions := make(map[string][]string)
+	boosts := make(map[string]float64)
+	total := 0
+	for _, name := range textFields(x, field) {
+		f, ok := x.Fields[name]
+		if !ok {
+			continue
+		}
+		terms, more := f.fuzzyTerms(word, distance, limit-total)
+		total += len(terms)
+		if more {
+			return nil, nil, errors.Errorf("more than %d terms matched", limit)
+		}
+		for term, d := range terms {
+			expansions[name] = append(expansions[name], term)
+			// near matches score lower than exact ones
+			boosts[term] = 1 / float64(1+d)
+		}
+	}
+	return expansions, boosts, nil
+}
+
+// levenshteinAutomaton accepts words within distance of word, a transposition of adjacent characters is one edit.
+// Its state is the row of edit distances from the read characters to each prefix of word.
+type levenshteinAutomaton struct {
+	word []rune
+	max  int
+}
+
+func newLevenshteinAutomaton(word string, max int) *levenshteinAutomaton {
+	return &levenshteinAutomaton{word: []rune(word), max: max}
+}
+
+func (a *levenshteinAutomaton) start() []int {
+	row := make([]int, len(a.word)+1)
+	for i := range row {
+		row[i] = i
+	}
+	return row
+}
+
+// step reads r after prevRune, prev2 is the state before reading prevRune
+func (a *levenshteinAutomaton) step(prev2, prev []int, prevRune, r rune) []int {
+	row := make([]int, len(prev))
+	row[0] = prev[0] + 1
+	for j := 1; j < len(row); j++ {
+		cost := 1
+		if a.word[j-1] == r {
+			cost = 0
+		}
+		row[j] = minInt(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+		if prev2 != nil && j > 1 && a.word[j-2] == r && a.word[j-1] == prevRune {
+			row[j] = minInt(row[j], prev2[j-2]+1)
+		}
+	}
+	return row
+}
+
+// canMatch checks if any word starting with read characters can be accepted
+func (a *levenshteinAutomaton) canMatch(row []int) bool {
+	for _, d := range row {
+		if d <= a.max {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *levenshteinAutomaton) distance(row []int) int {
+	return row[len(row)-1]
+}
+
+// match checks if word is accepted and returns its distance
+func (a *levenshteinAutomaton) match(word string) (int, bool) {
+	var prev2 []int
+	var prevRune rune
+	row := a.start()
+	for _, r := range word {
+		next := a.step(prev2, row, prevRune, r)
+		prev2, row, prevRune = row, next, r
+		if !a.canMatch(row) {
+			return 0, false
+		}
+	}
+	d := a.distance(row)
+	return d, d <= a.max
+}
+
+// nextPrefix returns the least string greater than all strings starting with prefix
+func nextPrefix(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+func minInt(nums ...int) int {
+	min := nums[0]
+	for _, n := range nums[1:] {
+		if n < min {
+			min = n
+		}
+	}
+	return min
+}
+
+// parseFuzzy splits fuzzy text like "brady~1" into word and distance, "brady~" means the max distance
+func parseFuzzy(text string) (string, string, bool) {
+	i := strings.LastIndex(text, "~")
+	if i <= 0 || strings.ContainsAny(text, ":/\"*?") {
+		return "", "", false
+	}
+	return text[:i], text[i+1:], true
+}
+
+func fuzzyDistance(s string) (int, error) {
+	if s == "" {
+		return MaxFuzzyDistance, nil
+	}
+	d, err := strconv.Atoi(s)
+	if err != nil || d < 0 || d > MaxFuzzyDistance {
+		return 0, errors.Errorf("invalid fuzzy distance %s", s)
+	}
+	return d, nil
+}
+
+// isRegexp checks if text is a regexp like "/br[ae]dy/"
+func isRegexp(text string) bool {
+	return len(text) > 2 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/")
+}
+
+// compileTermRegexp compiles pattern which matches whole terms, and returns literal prefix of matched terms
+func compileTermRegexp(pattern string) (*regexp.Regexp, string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	prefix, _ := re.LiteralPrefix()
+	anchored, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, "", err
+	}
+	return anchored, prefix, nil
+}
+
+// isWildcard checks if text is a wildcard pattern like "brad*" or "w?ld*card", words like urls are not
+func isWildcard(text string) bool {
+	return strings.ContainsAny(text, "*?") && !strings.ContainsAny(text, ":/\"")
+}
+
+// wildcardPrefix returns literal characters before the first wildcard
+func wildcardPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, "*?"); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// matchWildcard checks if term matches pattern, '?' matches any single character and '*' matches any characters
+func matchWildcard(pattern, term string) bool {
+	// position to retry when the last '*' matches one more character
+	star, retry := -1, 0
+	p, t := 0, 0
+	for t < len(term) {
+		_, tw := utf8.DecodeRuneInString(term[t:])
+		if p < len(pattern) {
+			r, pw := utf8.DecodeRuneInString(pattern[p:])
+			switch {
+			case r == '*':
+				star, retry = p, t
+				p += pw
+				continue
+			case r == '?' || pattern[p:p+pw] == term[t:t+tw]:
+				p += pw
+				t += tw
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		_, rw := utf8.DecodeRuneInString(term[retry:])
+		retry += rw
+		p, t = star+1, retry
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,118 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	cases := []struct {
+		pattern string
+		term    string
+		matched bool
+	}{
+		{"brad*", "brady", true},
+		{"brad*", "brad", true},
+		{"brad*", "bra", false},
+		{"w?ld*card", "wildcard", true},
+		{"w?ld*card", "wildestcard", true},
+		{"w?ld*card", "wldcard", false},
+		{"*owl", "bowl", true},
+		{"*o*", "tom", true},
+		{"诗?", "诗歌", true},
+		{"诗?", "诗", false},
+		{"*", "", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.matched, matchWildcard(c.pattern, c.term), c.pattern+" "+c.term)
+	}
+}
+
+func TestIsWildcard(t *testing.T) {
+	assert.True(t, isWildcard("brad*"))
+	assert.True(t, isWildcard("w?ld"))
+	assert.False(t, isWildcard("brady"))
+	assert.False(t, isWildcard("http://t.co/?a=1"))
+	assert.Equal(t, "w", wildcardPrefix("w?ld*"))
+}
+
+func TestIndex_expandFields(t *testing.T) {
+	index := mockedIndex(t)
+	expansions, err := index.expandFields("a", "b", func(term string) bool { return true })
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"a": {"bowl", "brady", "bunch"}}, expansions)
+	index.MaxExpansions = 2
+	_, err = index.expandFields("", "b", func(term string) bool { return true })
+	assert.NotNil(t, err)
+}
+
+func TestLevenshteinAutomaton(t *testing.T) {
+	cases := []struct {
+		word     string
+		term     string
+		distance int
+	}{
+		{"brady", "brady", 0},
+		{"brady", "brdy", 1},
+		{"brady", "bardy", 1},
+		{"brady", "bradley", 2},
+		{"brady", "tom", 5},
+		{"诗歌", "歌诗", 1},
+	}
+	for _, c := range cases {
+		a := newLevenshteinAutomaton(c.word, MaxFuzzyDistance)
+		rows := [][]int{a.start()}
+		runes := []rune(c.term)
+		for i, r := range runes {
+			var prev2 []int
+			var prevRune rune
+			if i > 0 {
+				prev2, prevRune = rows[i-1], runes[i-1]
+			}
+			rows = append(rows, a.step(prev2, rows[i], prevRune, r))
+		}
+		assert.Equal(t, c.distance, a.distance(rows[len(rows)-1]), c.word+" "+c.term)
+	}
+}
+
+func TestField_fuzzyTerms(t *testing.T) {
+	index := mockedIndex(t)
+	terms, more := index.Fields["a"].fuzzyTerms("brdy", 1, 10)
+	assert.False(t, more)
+	assert.Equal(t, map[string]int{"brady": 1}, terms)
+	terms, more = index.Fields["a"].fuzzyTerms("bowls", 2, 10)
+	assert.False(t, more)
+	assert.Equal(t, map[string]int{"bowl": 1}, terms)
+	terms, more = index.Fields["a"].fuzzyTerms("ryans", 2, 10)
+	assert.False(t, more)
+	assert.Equal(t, map[string]int{"ryan": 1}, terms)
+	_, more = index.Fields["a"].fuzzyTerms("ryans", 2, 0)
+	assert.True(t, more)
+}
+
+func TestIndex_fuzzyFields(t *testing.T) {
+	index := mockedIndex(t)
+	expansions, boosts, err := index.fuzzyFields("", "bowls", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"a": {"bowl"}}, expansions)
+	assert.Equal(t, map[string]float64{"bowl": 0.5}, boosts)
+	_, boosts, err = index.fuzzyFields("a", "bowl", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{"bowl": 1}, boosts)
+}
+
+func TestCompileTermRegexp(t *testing.T) {
+	re, prefix, err := compileTermRegexp("br[ae]dy")
+	assert.Nil(t, err)
+	assert.Equal(t, "br", prefix)
+	assert.True(t, re.MatchString("brady"))
+	assert.False(t, re.MatchString("bradyx"))
+	_, prefix, err = compileTermRegexp(".*dy")
+	assert.Nil(t, err)
+	assert.Equal(t, "", prefix)
+	_, _, err = compileTermRegexp("br[")
+	assert.NotNil(t, err)
+	assert.True(t, isRegexp("/b.*/"))
+	assert.False(t, isRegexp("//"))
+}
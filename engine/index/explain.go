@@ -0,0 +1,223 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Explanation tells whether and why a clause of query matches a doc, details explain its sub clauses
+type Explanation struct {
+	Clause      string  `json:"clause"`
+	Matched     bool    `json:"matched"`
+	Score       float64 `json:"score"`
+	Description string  `json:"description,omitempty"`
+	// Terms are analyzed or expanded from text of the clause
+	Terms []string `json:"terms,omitempty"`
+	// Filter is true if the clause filters docs without scoring them
+	Filter  bool           `json:"filter,omitempty"`
+	Details []*Explanation `json:"details,omitempty"`
+}
+
+// Explain tells how a doc matches the query string, the error is a *ParseError if query is invalid
+func (x *Index) Explain(query string, docid uint64) (*Explanation, error) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	if docid >= x.MaxDocID {
+		return nil, errors.Errorf("document %d not found", docid)
+	}
+	q, err := NewQuery(x, query)
+	if err != nil {
+		return nil, errors.Cause(err)
+	}
+	if q.Root == nil {
+		return &Explanation{Clause: q.Content, Description: "query matches nothing"}, nil
+	}
+	return explainNode(x, q.Root, docid), nil
+}
+
+// explainNode explains node by its own docs, and sub clauses of it one by one
+func explainNode(x *Index, node Node, docid uint64) *Explanation {
+	e := &Explanation{Clause: node.String()}
+	if filter, ok := node.(filterNode); ok {
+		e.Matched = filter.match(x, docid)
+	} else {
+		var doc Doc
+		doc, e.Matched = findDoc(node.search(x), docid)
+		e.Score = doc.Score
+	}
+
+	switch n := node.(type) {
+	case *boolQuery:
+		if n.op == OperatorOr {
+			e.Description = "sum of matched clauses, any of them is required"
+		} else {
+			e.Description = "sum of clauses, all of them are required"
+		}
+		for _, child := range n.children {
+			e.Details = append(e.Details, explainNode(x, child, docid))
+		}
+	case *notQuery:
+		e.Description = "clause must not match"
+		e.Details = []*Explanation{explainNode(x, n.child, docid)}
+	case *boostQuery:
+		e.Description = fmt.Sprintf("score of clause times boost %v", n.boost)
+		e.Details = []*Explanation{explainNode(x, n.child, docid)}
+	case *constantScoreQuery:
+		e.Description = "clause filters docs without scoring"
+		e.Filter = true
+		e.Details = []*Explanation{explainNode(x, n.child, docid)}
+	case *functionScoreQuery:
+		e.Description = fmt.Sprintf("score of clause and functions combined by %s, functions combined by %s",
+			n.boostMode, n.scoreMode)
+		e.Details = []*Explanation{explainNode(x, n.child, docid)}
+		for _, f := range n.functions {
+			fe := &Explanation{Clause: f.String(), Matched: true}
+			if f.filter != nil {
+				_, fe.Matched = findDoc(f.filter.search(x), docid)
+			}
+			if fe.Matched {
+				fe.Score = f.score(x, docid)
+			}
+			e.Details = append(e.Details, fe)
+		}
+	case *optionalQuery:
+		e.Description = "score of required clause plus scores of matched optional clauses"
+		e.Details = []*Explanation{explainNode(x, n.required, docid)}
+		for _, child := range n.optional {
+			e.Details = append(e.Details, explainNode(x, child, docid))
+		}
+	case *matchAllQuery:
+		e.Description = "matches all docs"
+	case *termQuery:
+		n.explain(x, docid, e)
+	case *phraseQuery:
+		n.explain(x, docid, e)
+	case *multiTermQuery:
+		n.explain(x, docid, e)
+	case *compareQuery, *existsQuery, *geoQuery, *ipQuery, *keywordQuery:
+		e.Description = "filter"
+		e.Filter = true
+	}
+	return e
+}
+
+func (t *termQuery) explain(x *Index, docid uint64, e *Explanation) {
+	e.Terms = t.terms
+	fields := x.searchFields(t.field, t.fields)
+	mode := t.mode
+	if mode == "" {
+		mode = x.MultiFieldMode
+	}
+	if mode == ModeBestFields && len(fields) > 1 {
+		e.Description = "score of the best field containing all terms"
+		for _, f := range fields {
+			fe := &Explanation{Clause: f.name, Matched: true, Description: "sum of terms in field"}
+			for _, term := range t.terms {
+				te := explainScore(x, f, term, docid)
+				fe.Matched = fe.Matched && te.Matched
+				fe.Score += te.Score
+				fe.Details = append(fe.Details, te)
+			}
+			if !fe.Matched {
+				fe.Score = 0
+			}
+			e.Details = append(e.Details, fe)
+		}
+		return
+	}
+	e.Description = "sum of terms, each scores by the best field containing it"
+	for _, term := range t.terms {
+		te := &Explanation{Clause: term, Description: "best of fields"}
+		for _, f := range fields {
+			fe := explainScore(x, f, term, docid)
+			if fe.Matched {
+				te.Matched = true
+				if fe.Score > te.Score {
+					te.Score = fe.Score
+				}
+			}
+			te.Details = append(te.Details, fe)
+		}
+		e.Details = append(e.Details, te)
+	}
+}
+
+// explainTerm explains constant score of a term in field of a doc, e.g. expanded from a wildcard
+func explainTerm(x *Index, f searchField, term string, docid uint64) *Explanation {
+	e := &Explanation{Clause: f.name + ":" + term}
+	docs, ok := x.searchTerm(term, f.name)
+	if !ok {
+		e.Description = "term not found"
+		return e
+	}
+	if _, e.Matched = findDoc(docs, docid); e.Matched {
+		e.Score = f.boost
+		e.Description = fmt.Sprintf("boost %v of field", f.boost)
+	}
+	return e
+}
+
+func (p *phraseQuery) explain(x *Index, docid uint64, e *Explanation) {
+	e.Terms = p.terms
+	if p.sloppy {
+		e.Description = fmt.Sprintf("terms within %d positions in any order, 1/(1+distance) times scores of terms "+
+			"in the best field times its boost", p.slop)
+	} else {
+		e.Description = "terms next to each other in order, scores of terms in the best field times its boost"
+	}
+}
+
+func (m *multiTermQuery) explain(x *Index, docid uint64, e *Explanation) {
+	var count int
+	for _, f := range x.searchFields(m.field, nil) {
+		count += len(m.expansions[f.name])
+		for _, term := range m.expansions[f.name] {
+			te := explainTerm(x, f, term, docid)
+			if !te.Matched {
+				continue
+			}
+			if boost, ok := m.boosts[term]; ok {
+				te.Score *= boost
+				te.Description += fmt.Sprintf(" times %v by edit distance", boost)
+			}
+			e.Terms = append(e.Terms, term)
+			e.Details = append(e.Details, te)
+		}
+	}
+	e.Description = fmt.Sprintf("best of %d expanded terms", count)
+}
+
+// findDoc finds doc in docs of non-decreasing order
+func findDoc(docs []Doc, docid uint64) (Doc, bool) {
+	i := sort.Search(len(docs), func(i int) bool { return docs[i].DocID >= docid })
+	if i < len(docs) && docs[i].DocID == docid {
+		return docs[i], true
+	}
+	return Doc{}, false
+}
+
+// String formats explanation as an indented tree
+func (e *Explanation) String() string {
+	var b bytes.Buffer
+	e.format(&b, 0)
+	return b.String()
+}
+
+func (e *Explanation) format(b *bytes.Buffer, depth int) {
+	matched := "no match"
+	if e.Matched {
+		matched = fmt.Sprintf("%v", e.Score)
+	}
+	fmt.Fprintf(b, "%s%s %s", strings.Repeat("  ", depth), matched, e.Clause)
+	if e.Description != "" {
+		fmt.Fprintf(b, ", %s", e.Description)
+	}
+	b.WriteString("\n")
+	for _, d := range e.Details {
+		d.format(b, depth+1)
+	}
+}
@@ -0,0 +1,55 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex_Explain(t *testing.T) {
+	index := mockedIndex(t)
+
+	e, err := index.Explain("tom brady b>30", 0)
+	assert.Nil(t, err)
+	assert.True(t, e.Matched)
+	docs, _ := index.Search("tom brady b>30")
+	assert.InDelta(t, docs[0].Score, e.Score, 1e-9)
+	assert.Equal(t, 3, len(e.Details))
+	assert.InDelta(t, e.Details[0].Score+e.Details[1].Score, e.Score, 1e-9)
+	assert.Equal(t, []string{"tom"}, e.Details[0].Terms)
+	assert.True(t, e.Details[0].Matched)
+	assert.True(t, e.Details[0].Score > 0)
+	assert.Equal(t, "a:tom", e.Details[0].Details[0].Details[0].Clause)
+	assert.Equal(t, "idf", e.Details[0].Details[0].Details[0].Details[0].Clause)
+	assert.Equal(t, "tf", e.Details[0].Details[0].Details[0].Details[1].Clause)
+	assert.True(t, e.Details[2].Filter)
+	assert.True(t, e.Details[2].Matched)
+
+	// doc 2 fails the filter
+	e, err = index.Explain("tom b<35", 2)
+	assert.Nil(t, err)
+	assert.False(t, e.Matched)
+	assert.True(t, e.Details[0].Matched)
+	assert.False(t, e.Details[1].Matched)
+
+	e, err = index.Explain("tom OR brady^2", 3)
+	assert.Nil(t, err)
+	assert.True(t, e.Matched)
+	assert.Equal(t, e.Details[1].Score, e.Score)
+	assert.False(t, e.Details[0].Matched)
+	assert.Equal(t, "brady^2", e.Details[1].Clause)
+	assert.InDelta(t, 2*e.Details[1].Details[0].Score, e.Details[1].Score, 1e-9)
+
+	e, err = index.Explain("brad* -bowl", 3)
+	assert.Nil(t, err)
+	assert.True(t, e.Matched)
+	assert.Equal(t, []string{"brady"}, e.Details[0].Terms)
+	assert.True(t, e.Details[1].Matched)
+	assert.False(t, e.Details[1].Details[0].Matched)
+	assert.Contains(t, e.String(), "no match a:bowl")
+
+	_, err = index.Explain("tom", 10)
+	assert.NotNil(t, err)
+	_, err = index.Explain("(tom", 0)
+	assert.Equal(t, &ParseError{Pos: 0, Reason: "missing ')' for '('"}, err)
+}
@@ -5,6 +5,8 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/cosmtrek/violet/pkg/analyzer"
+	"github.com/cosmtrek/violet/pkg/geo"
+	"github.com/cosmtrek/violet/pkg/skeleton"
 	"github.com/cosmtrek/violet/pkg/utils"
 	"github.com/kurrik/json"
 	"github.com/pkg/errors"
@@ -12,20 +14,41 @@ import (
 
 // Field holds source file and invert file
 type Field struct {
-	Name     string `json:"name"`
-	Type     uint64 `json:"type"`
-	MaxDocID uint64 `json:"maxdocid"`
-	Path     string
-	source   *Source
-	invert   *Invert
+	Name       string `json:"name"`
+	Type       uint64 `json:"type"`
+	MaxDocID   uint64 `json:"maxdocid"`
+	BaseDocID  uint64 `json:"basedocid"`
+	Deprecated bool   `json:"deprecated"`
+	// Offsets makes byte offsets of terms indexed with positions
+	Offsets bool `json:"offsets"`
+	// Similarity is the name of similarity scoring terms of the field, BM25 if empty
+	Similarity string `json:"similarity,omitempty"`
+	// K1 and B are BM25 parameters of the field, K1 limits how much term frequency counts
+	// and B is how much scores are normalized by length of the field
+	K1 float64 `json:"k1"`
+	B  float64 `json:"b"`
+	// DocCount and SumLength are the number of documents having terms in the field and the total of their lengths
+	DocCount  uint64 `json:"doc_count"`
+	SumLength uint64 `json:"sum_length"`
+	Path      string
+	source    *Source
+	invert    *Invert
+	present   *skeleton.Bitmap
+	// norms are lengths of the field in documents
+	norms      *skeleton.Norms
+	similarity Similarity
 }
 
 // NewField initializes a field struct
 func NewField(name string, ftype uint64, path string, segmenter analyzer.Analyzer) (*Field, error) {
 	field := &Field{
-		Name: name,
-		Type: ftype,
-		Path: path,
+		Name:    name,
+		Type:    ftype,
+		K1:      DefaultK1,
+		B:       DefaultB,
+		Path:    path,
+		present: skeleton.NewBitmap(),
+		norms:   skeleton.NewNorms(),
 	}
 	var err error
 	metafile := fieldMetaFile(path, name)
@@ -39,20 +62,52 @@ func NewField(name string, ftype uint64, path string, segmenter analyzer.Analyze
 			log.Errorf("failed to unmarshal meta %v into field %v, err: %s\n", meta, field, err.Error())
 			return nil, errors.Wrap(err, "failed to unmarshal meta into field")
 		}
+		// fields indexed before missing values were recorded have no present file, all their documents are present
+		if presentfile := presentFile(path, name); utils.FileExists(presentfile) {
+			if err = field.present.Load(presentfile); err != nil {
+				log.Errorf("failed to load present file of field %s, err: %s\n", name, err.Error())
+				return nil, errors.Wrap(err, "failed to load present file")
+			}
+		} else {
+			for docid := field.BaseDocID; docid < field.MaxDocID; docid++ {
+				field.present.Set(docid)
+			}
+		}
+		// fields indexed before lengths were recorded have no norms file
+		if normsfile := normsFile(path, name); utils.FileExists(normsfile) {
+			if err = field.norms.Load(normsfile); err != nil {
+				log.Errorf("failed to load norms file of field %s, err: %s\n", name, err.Error())
+				return nil, errors.Wrap(err, "failed to load norms file")
+			}
+		}
+	}
+	if field.similarity, err = newFieldSimilarity(field); err != nil {
+		log.Errorf("failed to create similarity of field %s, err: %s\n", name, err.Error())
+		return nil, errors.Wrap(err, "failed to create similarity")
 	}
 	if field.source, err = NewSource(path, name, ftype); err != nil {
 		log.Errorf("failed to create source file, err: %s\n", err.Error())
 		return nil, errors.Wrap(err, "failed to create source file")
 	}
-	if ftype == TString || ftype == TStore {
+	field.source.baseDocID = field.BaseDocID
+	if ftype == TString || ftype == TStore || ftype == TGeo || ftype == TIP || ftype == TKeyword {
 		if field.invert, err = NewInvert(path, name, ftype, segmenter); err != nil {
 			log.Errorf("failed to create invert file, err: %s\n", err.Error())
 			return nil, errors.Wrap(err, "failed to create invert file")
 		}
+		field.invert.offsets = field.Offsets
+		field.invert.norms = field.norms
 	}
 	return field, nil
 }
 
+// setBaseDocID makes the field start at docid, documents before it have no value for the field
+func (f *Field) setBaseDocID(docid uint64) {
+	f.BaseDocID = docid
+	f.MaxDocID = docid
+	f.source.baseDocID = docid
+}
+
 // addDocument adds document into source file and invert file that synced into disk at intervals
 func (f *Field) addDocument(docid uint64, doc string) error {
 	if docid != f.MaxDocID {
@@ -63,10 +118,28 @@ func (f *Field) addDocument(docid uint64, doc string) error {
 		return errors.Wrap(err, "failed to add document into source file")
 	}
 	if f.invert != nil {
-		if err = f.invert.addDocument(docid, doc); err != nil {
+		switch f.Type {
+		case TGeo:
+			err = f.invert.addTerms(docid, geoTerms(doc))
+		case TIP:
+			err = f.invert.addTerms(docid, ipTerms(doc))
+		case TKeyword:
+			err = f.invert.addTerms(docid, []string{doc})
+		default:
+			var length uint32
+			if length, err = f.invert.addDocument(docid, doc); err == nil && length > 0 {
+				f.norms.Set(docid, length)
+				f.DocCount++
+				f.SumLength += uint64(length)
+			}
+		}
+		if err != nil {
 			return errors.Wrap(err, "failed to add document into invert file")
 		}
 	}
+	if f.hasValue(doc) {
+		f.present.Set(docid)
+	}
 	f.MaxDocID++
 	if f.MaxDocID%InvertSyncInterval == 0 {
 		if f.invert != nil {
@@ -78,13 +151,59 @@ func (f *Field) addDocument(docid uint64, doc string) error {
 	return nil
 }
 
-// getDetail returns string if field type is TString or TStore, uint64 if field type is TNumber
+// hasValue checks if the content is a valid value of the field, missing values are stored as "" or 0 in source file
+func (f *Field) hasValue(doc string) bool {
+	if doc == "" {
+		return false
+	}
+	if isNumeric(f.Type) {
+		if _, err := parseNumeric(f.Type, doc); err != nil {
+			return false
+		}
+	}
+	if f.Type == TGeo {
+		if _, err := geo.ParsePoint(doc); err != nil {
+			return false
+		}
+	}
+	if f.Type == TIP {
+		if _, err := parseIP(doc); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// exists checks if the document has a value for the field
+func (f *Field) exists(docid uint64) bool {
+	if docid >= f.MaxDocID || docid < f.BaseDocID {
+		return false
+	}
+	return f.present.Has(docid)
+}
+
+// existDocs returns docs that have a value for the field
+func (f *Field) existDocs() []Doc {
+	var docs []Doc
+	for docid := f.BaseDocID; docid < f.MaxDocID; docid++ {
+		if f.present.Has(docid) {
+			docs = append(docs, Doc{DocID: docid})
+		}
+	}
+	return docs
+}
+
+// getDetail returns string if field type is TString, TStore, TKeyword, TGeo or TIP,
+// uint64 if field type is TNumber or TDate
 func (f *Field) getDetail(docid uint64) (string, uint64, bool, error) {
-	if docid > f.MaxDocID || f.source == nil {
+	if !f.exists(docid) || f.source == nil {
 		return "", 0, false, nil
 	}
 	val := f.source.getDetail(docid)
-	if f.Type == TString || f.Type == TStore {
+	if f.Type == TString || f.Type == TStore || f.Type == TKeyword {
+		return fmt.Sprintf("%s", val), 0, true, nil
+	}
+	if f.Type == TGeo || f.Type == TIP {
 		return fmt.Sprintf("%s", val), 0, true, nil
 	}
 	num, ok := val.(uint64)
@@ -101,9 +220,42 @@ func (f *Field) searchTerm(term string) ([]Doc, bool) {
 	return nil, false
 }
 
+// searchPhrase returns docs matching the phrase, scored by the sum of scores of terms
+func (f *Field) searchPhrase(terms []string, positions []int) ([]Doc, bool) {
+	if f.invert != nil {
+		docs, ok := f.invert.searchPhrase(terms, positions)
+		f.scoreTerms(docs, terms)
+		return docs, ok
+	}
+	return nil, false
+}
+
+// searchSloppy returns docs matching the sloppy phrase, scored by the sum of scores of terms
+// times 1/(1+distance) of terms
+func (f *Field) searchSloppy(terms []string, slop int) ([]Doc, bool) {
+	if f.invert != nil {
+		docs, ok := f.invert.searchSloppy(terms, slop)
+		f.scoreTerms(docs, terms)
+		return docs, ok
+	}
+	return nil, false
+}
+
+// sortValue returns value of number or date field, or ordinal of value of keyword field, false if doc lacks the field
+func (f *Field) sortValue(docid uint64) (uint64, bool) {
+	if !f.exists(docid) || f.source == nil {
+		return 0, false
+	}
+	return f.source.docValue(docid)
+}
+
 func (f *Field) filter(docid, value, ftype uint64) bool {
-	// current only support number type
-	if f.source == nil || f.Type != TNumber {
+	// current only support number and date type
+	if f.source == nil || !isNumeric(f.Type) {
+		return false
+	}
+	// documents lacking the field never pass
+	if !f.exists(docid) {
 		return false
 	}
 	return f.source.filter(docid, value, ftype)
@@ -124,8 +276,18 @@ func (f *Field) syncToDisk() error {
 			return errors.Wrap(err, "failed to sync source file to disk")
 		}
 	}
-	file := fieldMetaFile(f.Path, f.Name)
-	if err = utils.WriteJSON(file, f); err != nil {
+	if err = f.present.Save(presentFile(f.Path, f.Name)); err != nil {
+		return errors.Wrap(err, "failed to save present file to disk")
+	}
+	if err = f.norms.Save(normsFile(f.Path, f.Name)); err != nil {
+		return errors.Wrap(err, "failed to save norms file to disk")
+	}
+	return f.saveMeta()
+}
+
+// saveMeta writes meta of the field into json
+func (f *Field) saveMeta() error {
+	if err := utils.WriteJSON(fieldMetaFile(f.Path, f.Name), f); err != nil {
 		return errors.Wrap(err, "failed to write field into json")
 	}
 	return nil
@@ -135,6 +297,14 @@ func fieldMetaFile(filepath, field string) string {
 	return fmt.Sprintf("%v%v.json", filepath, field)
 }
 
+func presentFile(filepath, field string) string {
+	return fmt.Sprintf("%v%v.bitmap", filepath, field)
+}
+
+func normsFile(filepath, field string) string {
+	return fmt.Sprintf("%v%v.norms", filepath, field)
+}
+
 func (f *Field) String() string {
 	return fmt.Sprintf("[FIELD] name: %s, type: %s, maxdocid: %d, path: %s, source: %s, invert: %s",
 		f.Name, f.Type, f.MaxDocID, f.Path, f.source.string(), f.invert.string())
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"os"
 	"testing"
 
 	"github.com/cosmtrek/violet/pkg/utils"
@@ -59,3 +60,21 @@ func TestField_addDocument_searchTerm_getDetail(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, expectedDoc7, doc7)
 }
+
+func TestNewField_WithoutPresentFile(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	field, err := NewField("fieldC", TNumber, path, segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, field.addDocument(uint64(0), "1"))
+	assert.Nil(t, field.addDocument(uint64(1), "2"))
+	assert.Nil(t, field.syncToDisk())
+	// fields indexed before missing values were recorded have a meta file but no present file
+	assert.Nil(t, os.Remove(presentFile(path, "fieldC")))
+
+	field, err = NewField("fieldC", TNumber, path, segmenter())
+	assert.Nil(t, err)
+	assert.True(t, field.exists(uint64(0)))
+	assert.True(t, field.exists(uint64(1)))
+	assert.False(t, field.exists(uint64(2)))
+}
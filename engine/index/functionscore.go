@@ -0,0 +1,431 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DecayGauss decays scores along a normal curve from the origin
+	DecayGauss = "gauss"
+	// DecayExp decays scores exponentially from the origin
+	DecayExp = "exp"
+	// DecayLinear decays scores linearly from the origin to 0
+	DecayLinear = "linear"
+)
+
+// functionScoreQuery changes scores of docs of child by functions of their fields. Scores of functions applying to
+// a doc combine by score mode, then with the score of child by boost mode.
+type functionScoreQuery struct {
+	child     Node
+	functions []*weightedFunction
+	scoreMode string
+	boostMode string
+	maxBoost  float64
+}
+
+// weightedFunction is a function times weight, applying to docs matching filter if there is one,
+// it's weight alone if function is nil
+type weightedFunction struct {
+	function scoreFunction
+	weight   float64
+	filter   Node
+}
+
+// scoreFunction computes a factor of score of a doc by its field
+type scoreFunction interface {
+	score(x *Index, docid uint64) float64
+	String() string
+}
+
+func (q *functionScoreQuery) search(x *Index) []Doc {
+	docs := q.child.search(x)
+	filters := make([][]Doc, len(q.functions))
+	for i, f := range q.functions {
+		if f.filter != nil {
+			filters[i] = f.filter.search(x)
+		}
+	}
+	for i := range docs {
+		docs[i].Score = q.combine(docs[i].Score, q.functionScore(x, docs[i].DocID, filters))
+	}
+	return docs
+}
+
+// functionScore combines scores of functions applying to doc by score mode, it's 1 if none applies
+func (q *functionScoreQuery) functionScore(x *Index, docid uint64, filters [][]Doc) float64 {
+	var scores []float64
+	for i, f := range q.functions {
+		if f.filter != nil {
+			if _, ok := findDoc(filters[i], docid); !ok {
+				continue
+			}
+		}
+		scores = append(scores, f.score(x, docid))
+		if q.scoreMode == "first" {
+			break
+		}
+	}
+	if len(scores) == 0 {
+		return 1
+	}
+	score := scores[0]
+	for _, s := range scores[1:] {
+		switch q.scoreMode {
+		case "sum", "avg":
+			score += s
+		case "max":
+			score = math.Max(score, s)
+		case "min":
+			score = math.Min(score, s)
+		default:
+			score *= s
+		}
+	}
+	if q.scoreMode == "avg" {
+		score /= float64(len(scores))
+	}
+	return math.Min(score, q.maxBoost)
+}
+
+// combine combines score of query with score of functions by boost mode
+func (q *functionScoreQuery) combine(query, function float64) float64 {
+	switch q.boostMode {
+	case "replace":
+		return function
+	case "sum":
+		return query + function
+	case "avg":
+		return (query + function) / 2
+	case "max":
+		return math.Max(query, function)
+	case "min":
+		return math.Min(query, function)
+	default:
+		return query * function
+	}
+}
+
+func (q *functionScoreQuery) String() string {
+	functions := make([]string, len(q.functions))
+	for i, f := range q.functions {
+		functions[i] = f.String()
+	}
+	return fmt.Sprintf("function_score(%s, %s)", q.child.String(), strings.Join(functions, ", "))
+}
+
+// score returns score of function times weight, scores below 0 are 0
+func (f *weightedFunction) score(x *Index, docid uint64) float64 {
+	score := f.weight
+	if f.function != nil {
+		score *= f.function.score(x, docid)
+	}
+	if score < 0 || math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+func (f *weightedFunction) String() string {
+	text := fmt.Sprintf("weight %v", f.weight)
+	if f.function != nil {
+		text = fmt.Sprintf("%s * %v", f.function.String(), f.weight)
+	}
+	if f.filter != nil {
+		text += " if " + f.filter.String()
+	}
+	return text
+}
+
+// decayFunction scores docs by distance of a number or date field from origin, a doc scores 1 within offset of
+// origin, and decay at scale further, docs lacking the field score 1
+type decayFunction struct {
+	kind   string
+	field  string
+	origin float64
+	scale  float64
+	offset float64
+	decay  float64
+}
+
+func (d *decayFunction) score(x *Index, docid uint64) float64 {
+	value, ok := x.Fields[d.field].sortValue(docid)
+	if !ok {
+		return 1
+	}
+	distance := math.Max(0, math.Abs(float64(value)-d.origin)-d.offset)
+	switch d.kind {
+	case DecayGauss:
+		// decay at scale as exp(-scale^2 / 2sigma^2) == decay
+		sigma2 := -d.scale * d.scale / (2 * math.Log(d.decay))
+		return math.Exp(-distance * distance / (2 * sigma2))
+	case DecayExp:
+		return math.Exp(math.Log(d.decay) / d.scale * distance)
+	default:
+		s := d.scale / (1 - d.decay)
+		return math.Max(0, (s-distance)/s)
+	}
+}
+
+func (d *decayFunction) String() string {
+	return fmt.Sprintf("%s(%s, origin %v, scale %v, offset %v, decay %v)", d.kind, d.field, d.origin, d.scale, d.offset, d.decay)
+}
+
+// fieldValueFactor scores docs by value of a number or date field times factor, then modifier applies,
+// docs lacking the field take missing as the value, or score 1 if there is none
+type fieldValueFactor struct {
+	field    string
+	factor   float64
+	modifier string
+	missing  *float64
+}
+
+// modifiers of field value factor
+var modifiers = map[string]func(float64) float64{
+	"none":       func(v float64) float64 { return v },
+	"log":        math.Log10,
+	"log1p":      func(v float64) float64 { return math.Log10(v + 1) },
+	"log2p":      func(v float64) float64 { return math.Log10(v + 2) },
+	"ln":         math.Log,
+	"ln1p":       math.Log1p,
+	"ln2p":       func(v float64) float64 { return math.Log(v + 2) },
+	"square":     func(v float64) float64 { return v * v },
+	"sqrt":       math.Sqrt,
+	"reciprocal": func(v float64) float64 { return 1 / v },
+}
+
+func (f *fieldValueFactor) score(x *Index, docid uint64) float64 {
+	var value float64
+	if v, ok := x.Fields[f.field].sortValue(docid); ok {
+		value = float64(v)
+	} else if f.missing != nil {
+		value = *f.missing
+	} else {
+		return 1
+	}
+	return modifiers[f.modifier](f.factor * value)
+}
+
+func (f *fieldValueFactor) String() string {
+	return fmt.Sprintf("field_value_factor(%s, factor %v, modifier %s)", f.field, f.factor, f.modifier)
+}
+
+// functionParams is a function of function score like {"gauss": {"created": {"origin": "now", "scale": "7d"}},
+// "weight": 2, "filter": {"match": {"text": "bowl"}}}
+type functionParams struct {
+	Filter           json.RawMessage `json:"filter"`
+	Weight           *float64        `json:"weight"`
+	Gauss            json.RawMessage `json:"gauss"`
+	Exp              json.RawMessage `json:"exp"`
+	Linear           json.RawMessage `json:"linear"`
+	FieldValueFactor *struct {
+		Field    string   `json:"field"`
+		Factor   *float64 `json:"factor"`
+		Modifier string   `json:"modifier"`
+		Missing  *float64 `json:"missing"`
+	} `json:"field_value_factor"`
+}
+
+// compileFunctionScore compiles {"query": {...}, "functions": [...], "score_mode": "multiply",
+// "boost_mode": "multiply", "max_boost": 10}, a single function can be given without functions
+func (p *parser) compileFunctionScore(body json.RawMessage) (Node, error) {
+	var params struct {
+		functionParams
+		Query     json.RawMessage  `json:"query"`
+		Functions []functionParams `json:"functions"`
+		ScoreMode string           `json:"score_mode"`
+		BoostMode string           `json:"boost_mode"`
+		MaxBoost  *float64         `json:"max_boost"`
+	}
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil, errors.Wrap(err, "invalid function_score")
+	}
+	q := &functionScoreQuery{
+		child:     &matchAllQuery{},
+		scoreMode: strings.ToLower(params.ScoreMode),
+		boostMode: strings.ToLower(params.BoostMode),
+		maxBoost:  math.MaxFloat64,
+	}
+	switch q.scoreMode {
+	case "":
+		q.scoreMode = "multiply"
+	case "multiply", "sum", "avg", "first", "max", "min":
+	default:
+		return nil, errors.Errorf("invalid score_mode %s", params.ScoreMode)
+	}
+	switch q.boostMode {
+	case "":
+		q.boostMode = "multiply"
+	case "multiply", "replace", "sum", "avg", "max", "min":
+	default:
+		return nil, errors.Errorf("invalid boost_mode %s", params.BoostMode)
+	}
+	if params.MaxBoost != nil {
+		q.maxBoost = *params.MaxBoost
+	}
+	if len(params.Query) > 0 {
+		child, err := p.compileClause(params.Query)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return nil, nil
+		}
+		q.child = child
+	}
+
+	functions := params.Functions
+	if len(functions) == 0 {
+		functions = []functionParams{params.functionParams}
+	}
+	for _, fp := range functions {
+		f, err := p.compileFunction(fp)
+		if err != nil {
+			return nil, err
+		}
+		q.functions = append(q.functions, f)
+	}
+	return q, nil
+}
+
+func (p *parser) compileFunction(params functionParams) (*weightedFunction, error) {
+	f := &weightedFunction{weight: 1}
+	if params.Weight != nil {
+		if *params.Weight < 0 {
+			return nil, errors.Errorf("weight %v must not be negative", *params.Weight)
+		}
+		f.weight = *params.Weight
+	}
+	if len(params.Filter) > 0 {
+		filter, err := p.compileClause(params.Filter)
+		if err != nil {
+			return nil, err
+		}
+		f.filter = filter
+		if filter == nil {
+			// matches nothing
+			f.filter = &boolQuery{op: OperatorOr}
+		}
+	}
+
+	var count int
+	for kind, body := range map[string]json.RawMessage{DecayGauss: params.Gauss, DecayExp: params.Exp, DecayLinear: params.Linear} {
+		if len(body) == 0 {
+			continue
+		}
+		count++
+		decay, err := p.compileDecay(kind, body)
+		if err != nil {
+			return nil, err
+		}
+		f.function = decay
+	}
+	if v := params.FieldValueFactor; v != nil {
+		count++
+		if !isNumeric(p.index.FieldMeta[v.Field]) {
+			return nil, errors.Errorf("field %s of field_value_factor is not a number or date field", v.Field)
+		}
+		factor := &fieldValueFactor{field: v.Field, factor: 1, modifier: strings.ToLower(v.Modifier), missing: v.Missing}
+		if v.Factor != nil {
+			factor.factor = *v.Factor
+		}
+		if factor.modifier == "" {
+			factor.modifier = "none"
+		}
+		if _, ok := modifiers[factor.modifier]; !ok {
+			return nil, errors.Errorf("invalid modifier %s of field_value_factor", v.Modifier)
+		}
+		f.function = factor
+	}
+	if count > 1 {
+		return nil, errors.New("a function must have one of gauss, exp, linear and field_value_factor")
+	}
+	if count == 0 && params.Weight == nil {
+		return nil, errors.New("a function must have a weight or one of gauss, exp, linear and field_value_factor")
+	}
+	return f, nil
+}
+
+// compileDecay compiles {"field": {"origin": "now", "scale": "7d", "offset": "1d", "decay": 0.5}} of a date field,
+// or numbers of a number field, origin of dates is now by default
+func (p *parser) compileDecay(kind string, body json.RawMessage) (*decayFunction, error) {
+	var fields map[string]struct {
+		Origin json.RawMessage `json:"origin"`
+		Scale  json.RawMessage `json:"scale"`
+		Offset json.RawMessage `json:"offset"`
+		Decay  *float64        `json:"decay"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil || len(fields) != 1 {
+		return nil, errors.Errorf("%s must have one field", kind)
+	}
+	for field, params := range fields {
+		ftype := p.index.FieldMeta[field]
+		if !isNumeric(ftype) {
+			return nil, errors.Errorf("field %s of %s is not a number or date field", field, kind)
+		}
+		d := &decayFunction{kind: kind, field: field, decay: 0.5}
+		if params.Decay != nil {
+			d.decay = *params.Decay
+		}
+		if d.decay <= 0 || d.decay >= 1 {
+			return nil, errors.Errorf("decay %v of %s must be between 0 and 1", d.decay, kind)
+		}
+		var err error
+		if d.origin, err = decayOrigin(ftype, params.Origin); err != nil {
+			return nil, errors.Wrapf(err, "invalid origin of %s", kind)
+		}
+		if d.scale, err = decayDistance(ftype, params.Scale); err != nil || d.scale <= 0 {
+			return nil, errors.Errorf("scale %s of %s must be positive", params.Scale, kind)
+		}
+		if len(params.Offset) > 0 {
+			if d.offset, err = decayDistance(ftype, params.Offset); err != nil {
+				return nil, errors.Wrapf(err, "invalid offset of %s", kind)
+			}
+		}
+		return d, nil
+	}
+	return nil, nil
+}
+
+// decayOrigin parses origin of a number, or a date which is now if it's missing or "now"
+func decayOrigin(ftype uint64, raw json.RawMessage) (float64, error) {
+	if len(raw) == 0 && ftype == TDate {
+		return float64(time.Now().Unix()), nil
+	}
+	text, err := rawString(raw)
+	if err != nil {
+		return 0, err
+	}
+	if ftype != TDate {
+		return strconv.ParseFloat(text, 64)
+	}
+	if text == "now" {
+		return float64(time.Now().Unix()), nil
+	}
+	sec, err := parseDate(text)
+	return float64(sec), err
+}
+
+// decayDistance parses a distance of numbers, or of dates in seconds like "7d", "12h", "1w" or "90s"
+func decayDistance(ftype uint64, raw json.RawMessage) (float64, error) {
+	text, err := rawString(raw)
+	if err != nil {
+		return 0, err
+	}
+	if v, err := strconv.ParseFloat(text, 64); err == nil || ftype != TDate || text == "" {
+		return v, err
+	}
+	units := map[byte]float64{'d': 24 * 60 * 60, 'w': 7 * 24 * 60 * 60}
+	if unit, ok := units[text[len(text)-1]]; ok {
+		v, err := strconv.ParseFloat(text[:len(text)-1], 64)
+		return v * unit, err
+	}
+	duration, err := time.ParseDuration(text)
+	return duration.Seconds(), err
+}
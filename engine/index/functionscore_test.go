@@ -0,0 +1,103 @@
+package index
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayFunction(t *testing.T) {
+	index := tweetsIndex(t)
+	origin, err := parseDate("2018-02-04")
+	assert.Nil(t, err)
+	day := 24 * 60 * 60.0
+	for _, kind := range []string{DecayGauss, DecayExp, DecayLinear} {
+		d := &decayFunction{kind: kind, field: "created", origin: float64(origin), scale: 363 * day, offset: day, decay: 0.5}
+		// doc 0 is at origin, docs 2 and 3 at offset plus scale before and after it, doc 1 lacks the field
+		assert.Equal(t, 1.0, d.score(index, 0), kind)
+		assert.InDelta(t, 0.5, d.score(index, 2), 1e-9, kind)
+		assert.Equal(t, 1.0, d.score(index, 1), kind)
+		assert.InDelta(t, 0.5, d.score(index, 3), 1e-9, kind)
+	}
+	d := &decayFunction{kind: DecayLinear, field: "created", origin: float64(origin), scale: 100 * day, decay: 0.5}
+	assert.Equal(t, 0.0, d.score(index, 2))
+}
+
+func TestIndex_SearchDSL_FunctionScore(t *testing.T) {
+	index := tweetsIndex(t)
+	cases := []struct {
+		request  string
+		expected []uint64
+	}{
+		{`{"query": {"function_score": {"query": {"match": {"text": "super"}},
+			"gauss": {"created": {"origin": "2019-02-03", "scale": "365d"}}, "boost_mode": "replace"}}}`,
+			[]uint64{1, 3, 0, 2}},
+		{`{"query": {"function_score": {"query": {"match": {"text": "super"}},
+			"functions": [{"exp": {"created": {"origin": "2017-02-05", "scale": "30d", "decay": 0.3}}}]}}}`,
+			[]uint64{2, 1, 0, 3}},
+		{`{"query": {"function_score": {"query": {"match": {"text": "super"}},
+			"functions": [{"linear": {"created": {"origin": "2017-02-05", "scale": "1w"}}}, {"weight": 0}],
+			"score_mode": "first"}}}`,
+			[]uint64{2, 1, 0, 3}},
+		{`{"query": {"function_score": {"functions": [
+			{"filter": {"term": {"author": "matt"}}, "weight": 3},
+			{"filter": {"match": {"text": "party"}}, "weight": 2}], "score_mode": "sum", "boost_mode": "replace"}}}`,
+			[]uint64{2, 3, 0, 1}},
+		{`{"query": {"function_score": {"query": {"match": {"text": "bowl"}},
+			"functions": [{"filter": {"match": {"text": "champion"}}, "weight": 10}], "max_boost": 5, "boost_mode": "sum"}}}`,
+			[]uint64{1, 0, 2, 3}},
+	}
+	for _, c := range cases {
+		var req SearchRequest
+		assert.Nil(t, json.Unmarshal([]byte(c.request), &req), c.request)
+		result, err := index.SearchDSL(&req)
+		if assert.Nil(t, err, c.request) {
+			assert.Equal(t, c.expected, docIDs(result.Docs), c.request)
+		}
+	}
+
+	for _, request := range []string{
+		`{"function_score": {"gauss": {"text": {"origin": 1, "scale": 1}}}}`,
+		`{"function_score": {"gauss": {"created": {"origin": "2019-02-03", "scale": "0d"}}}}`,
+		`{"function_score": {"gauss": {"created": {"scale": "1d", "decay": 1}}}}`,
+		`{"function_score": {"gauss": {"created": {"origin": "yesterday", "scale": "1d"}}}}`,
+		`{"function_score": {"exp": {"created": {"scale": "1d"}}, "field_value_factor": {"field": "created"}}}`,
+		`{"function_score": {"field_value_factor": {"field": "author"}}}`,
+		`{"function_score": {"field_value_factor": {"field": "created", "modifier": "cube"}}}`,
+		`{"function_score": {}}`,
+		`{"function_score": {"weight": -1}}`,
+		`{"function_score": {"weight": 1, "score_mode": "median"}}`,
+		`{"function_score": {"weight": 1, "boost_mode": "median"}}`,
+	} {
+		_, err := index.CompileDSL(json.RawMessage(request))
+		assert.NotNil(t, err, request)
+	}
+}
+
+func TestFieldValueFactor(t *testing.T) {
+	index := mockedIndex(t)
+	missing := 9.0
+	f := &fieldValueFactor{field: "b", factor: 1, modifier: "log1p"}
+	assert.InDelta(t, math.Log10(40), f.score(index, 0), 1e-9)
+	assert.Equal(t, 1.0, f.score(index, 3))
+	f = &fieldValueFactor{field: "b", factor: 2, modifier: "sqrt", missing: &missing}
+	assert.InDelta(t, math.Sqrt(18), f.score(index, 3), 1e-9)
+
+	var req SearchRequest
+	assert.Nil(t, json.Unmarshal([]byte(`{"query": {"function_score": {"query": {"match": {"a": "super"}},
+		"field_value_factor": {"field": "b", "modifier": "log1p"}}}}`), &req))
+	result, err := index.SearchDSL(&req)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0, 1}, docIDs(result.Docs))
+
+	root, err := index.CompileDSL(json.RawMessage(`{"function_score": {"query": {"match": {"a": "super"}},
+		"field_value_factor": {"field": "b", "factor": 0.5}, "weight": 2}}`))
+	assert.Nil(t, err)
+	e := explainNode(index, root, 1)
+	assert.True(t, e.Matched)
+	assert.Equal(t, 2, len(e.Details))
+	assert.Equal(t, 31.0, e.Details[1].Score)
+	assert.InDelta(t, e.Details[0].Score*31, e.Score, 1e-9)
+}
@@ -0,0 +1,144 @@
+package index
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cosmtrek/violet/pkg/geo"
+	"github.com/pkg/errors"
+)
+
+const (
+	// GeoPrecision is the max length of geohash cells indexed for geo fields
+	GeoPrecision = 8
+	// geoMaxCells limits cells looked up for a geo shape
+	geoMaxCells = 64
+)
+
+// GeoShape is an area for filtering geo fields
+type GeoShape struct {
+	Box    geo.Box
+	Center geo.Point
+	Radius float64
+	Circle bool
+}
+
+// ParseGeoShape parses "within(lat,lon,distance)" or "box(top,left,bottom,right)"
+func ParseGeoShape(text string) (*GeoShape, error) {
+	open := strings.Index(text, "(")
+	if open < 0 || !strings.HasSuffix(text, ")") {
+		return nil, errors.Errorf("invalid geo shape %s", text)
+	}
+	args := strings.Split(text[open+1:len(text)-1], ",")
+	switch text[:open] {
+	case "within":
+		if len(args) != 3 {
+			return nil, errors.New("within needs lat, lon and distance")
+		}
+		center, err := geo.ParsePoint(args[0] + "," + args[1])
+		if err != nil {
+			return nil, err
+		}
+		radius, err := geo.ParseDistance(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return &GeoShape{Box: geo.CircleBox(center, radius), Center: center, Radius: radius, Circle: true}, nil
+	case "box":
+		if len(args) != 4 {
+			return nil, errors.New("box needs top, left, bottom and right")
+		}
+		var vals [4]float64
+		for i, arg := range args {
+			val, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid box")
+			}
+			vals[i] = val
+		}
+		topLeft := geo.Point{Lat: vals[0], Lon: vals[1]}
+		bottomRight := geo.Point{Lat: vals[2], Lon: vals[3]}
+		if !topLeft.Valid() || !bottomRight.Valid() || topLeft.Lat < bottomRight.Lat {
+			return nil, errors.Errorf("invalid box %s", text)
+		}
+		return &GeoShape{Box: geo.Box{Top: vals[0], Left: vals[1], Bottom: vals[2], Right: vals[3]}}, nil
+	default:
+		return nil, errors.Errorf("unknown geo shape %s", text)
+	}
+}
+
+// Contains checks if the point is in shape
+func (s *GeoShape) Contains(p geo.Point) bool {
+	if s.Circle {
+		return geo.Distance(s.Center, p) <= s.Radius
+	}
+	return s.Box.Contains(p)
+}
+
+// geoTerms returns geohash cells of all precisions containing the point
+func geoTerms(doc string) []string {
+	point, err := geo.ParsePoint(doc)
+	if err != nil {
+		return nil
+	}
+	hash := geo.Encode(point, GeoPrecision)
+	terms := make([]string, GeoPrecision)
+	for i := range terms {
+		terms[i] = hash[:i+1]
+	}
+	return terms
+}
+
+// searchGeo looks up cells covering the shape and then checks locations of docs in these cells
+func (f *Field) searchGeo(shape *GeoShape) ([]Doc, bool) {
+	if f.invert == nil || f.Type != TGeo {
+		return nil, false
+	}
+	precision := geo.Precision(shape.Box, GeoPrecision, geoMaxCells)
+	var candidates []Doc
+	for _, cell := range geo.Cover(shape.Box, precision) {
+		cellDocs, ok := f.invert.searchTerm(cell)
+		if ok {
+			candidates, _ = MergeDocIDs(candidates, cellDocs)
+		}
+	}
+	var docs []Doc
+	for _, doc := range candidates {
+		if f.exists(doc.DocID) && shape.Contains(f.source.getPoint(doc.DocID)) {
+			docs = append(docs, doc)
+		}
+	}
+	if len(docs) == 0 {
+		return nil, false
+	}
+	return docs, true
+}
+
+// SortByDistance sorts docs by distance of field to the point, docs lacking the field are put last
+func (x *Index) SortByDistance(docs []Doc, field string, lat, lon float64) ([]Doc, error) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	f, ok := x.Fields[field]
+	if !ok || f.Type != TGeo {
+		return nil, errors.Errorf("%s is not a geo field", field)
+	}
+	origin := geo.Point{Lat: lat, Lon: lon}
+	distances := make(map[uint64]float64, len(docs))
+	for _, doc := range docs {
+		if f.exists(doc.DocID) {
+			distances[doc.DocID] = geo.Distance(origin, f.source.getPoint(doc.DocID))
+		}
+	}
+	sorted := make([]Doc, len(docs))
+	copy(sorted, docs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		di, iok := distances[sorted[i].DocID]
+		dj, jok := distances[sorted[j].DocID]
+		if iok != jok {
+			return iok
+		}
+		return di < dj
+	})
+	return sorted, nil
+}
@@ -0,0 +1,61 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGeoShape(t *testing.T) {
+	shape, err := ParseGeoShape("within(39.9,116.4,10km)")
+	assert.Nil(t, err)
+	assert.True(t, shape.Circle)
+	assert.Equal(t, 10000.0, shape.Radius)
+	shape, err = ParseGeoShape("box(40.5,115.5,38.5,117.5)")
+	assert.Nil(t, err)
+	assert.False(t, shape.Circle)
+	_, err = ParseGeoShape("box(38.5,115.5,40.5,117.5)")
+	assert.NotNil(t, err)
+	_, err = ParseGeoShape("within(39.9,116.4)")
+	assert.NotNil(t, err)
+	_, err = ParseGeoShape("near(39.9,116.4)")
+	assert.NotNil(t, err)
+}
+
+func TestIndex_SearchGeo_SortByDistance(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	err = index.IndexFields(map[string]uint64{"a": TString, "loc": TGeo})
+	assert.Nil(t, err)
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "tiananmen square", "loc": "39.9087,116.3975"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "sanlitun bar street", "loc": "39.9334,116.4551"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "tianjin eye", "loc": "39.1530,117.1823"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "the bund", "loc": "31.2400,121.4900"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "somewhere street"}))
+	assert.Nil(t, index.SyncToDisk())
+
+	doc0, ok := index.GetDocument(0)
+	assert.True(t, ok)
+	assert.Equal(t, "39.9087,116.3975", doc0["loc"])
+
+	docs1, found1 := index.Search("loc:within(39.9,116.4,10km)")
+	assert.True(t, found1)
+	assert.EqualValues(t, []Doc{{DocID: 0}, {DocID: 1}}, docs1)
+	docs2, found2 := index.Search("loc:box(40.5,115.5,38.5,117.5)")
+	assert.True(t, found2)
+	assert.EqualValues(t, []Doc{{DocID: 0}, {DocID: 1}, {DocID: 2}}, docs2)
+	docs3, found3 := index.Search("street loc:within(39.9,116.4,10km)")
+	assert.True(t, found3)
+	assert.Equal(t, []uint64{1}, docIDs(docs3))
+	_, found4 := index.Search("loc:within(0,0,10km)")
+	assert.False(t, found4)
+
+	sorted, err := index.SortByDistance(index.allDocs(), "loc", 39.1, 117.2)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []Doc{{DocID: 2}, {DocID: 1}, {DocID: 0}, {DocID: 3}, {DocID: 4}}, sorted)
+	_, err = index.SortByDistance(sorted, "a", 39.1, 117.2)
+	assert.NotNil(t, err)
+}
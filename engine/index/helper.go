@@ -11,7 +11,7 @@ var (
 )
 
 const (
-	reCompare = "[a-zA-Z]+([<|=|>])[0-9]+"
+	reCompare = `^[a-zA-Z_][a-zA-Z0-9_.]*(>=|<=|!=|<|>|=)[^<>=!]`
 )
 
 func segmenter() *analyzer.Segmenter {
@@ -22,7 +22,7 @@ func segmenter() *analyzer.Segmenter {
 	return gsegmenter
 }
 
-// MergeDocIDs merges docs in non-decreasing order
+// MergeDocIDs merges docs in non-decreasing order, scores of the same doc are added up
 func MergeDocIDs(a []Doc, b []Doc) ([]Doc, bool) {
 	aLen := len(a)
 	bLen := len(b)
@@ -33,8 +33,9 @@ func MergeDocIDs(a []Doc, b []Doc) ([]Doc, bool) {
 	var i, j, k int
 	c := make([]Doc, len(a)+len(b))
 	for i < aLen && j < bLen {
-		if a[i] == b[j] {
+		if a[i].DocID == b[j].DocID {
 			c[k] = a[i]
+			c[k].Score += b[j].Score
 			i++
 			j++
 			k++
@@ -68,7 +69,33 @@ func MergeDocIDs(a []Doc, b []Doc) ([]Doc, bool) {
 	return c[:k], true
 }
 
-// IntersectDocIDs returns the intersections of two doc ids
+// maxMergeDocIDs merges docs in non-decreasing order, the same doc keeps the higher score
+func maxMergeDocIDs(a []Doc, b []Doc) []Doc {
+	c := make([]Doc, 0, len(a)+len(b))
+	var i, j int
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].DocID == b[j].DocID:
+			doc := a[i]
+			if b[j].Score > doc.Score {
+				doc.Score = b[j].Score
+			}
+			c = append(c, doc)
+			i++
+			j++
+		case a[i].DocID < b[j].DocID:
+			c = append(c, a[i])
+			i++
+		default:
+			c = append(c, b[j])
+			j++
+		}
+	}
+	c = append(c, a[i:]...)
+	return append(c, b[j:]...)
+}
+
+// IntersectDocIDs returns the intersections of two doc ids, scores of the same doc are added up
 func IntersectDocIDs(a []Doc, b []Doc) ([]Doc, bool) {
 	aLen := len(a)
 	bLen := len(b)
@@ -85,8 +112,9 @@ func IntersectDocIDs(a []Doc, b []Doc) ([]Doc, bool) {
 	}
 	c := make([]Doc, cLen)
 	for i < aLen && j < bLen {
-		if a[i] == b[j] {
+		if a[i].DocID == b[j].DocID {
 			c[k] = a[i]
+			c[k].Score += b[j].Score
 			i++
 			j++
 			k++
@@ -135,7 +163,7 @@ func ExcludeDocIDs(a []Doc, b []Doc) ([]Doc, bool) {
 	return c[:k], true
 }
 
-// HasCompare checks if the string contains '<', '=' or '>'
+// HasCompare checks if the string is a comparison like "len>5", "len>=5" or "len!=5" and returns the operator
 func HasCompare(text string) (string, bool) {
 	if text == "" {
 		return "", false
@@ -93,3 +93,38 @@ func TestExcludeDocIDs(t *testing.T) {
 	assert.True(t, found)
 	assert.EqualValues(t, expected, actual)
 }
+
+func TestHasCompare(t *testing.T) {
+	cases := []struct {
+		text     string
+		operator string
+		ok       bool
+	}{
+		{"len>5", ">", true},
+		{"len>=5", ">=", true},
+		{"len<=5", "<=", true},
+		{"len!=5", "!=", true},
+		{"len=5", "=", true},
+		{"field_1<5", "<", true},
+		{"user.age>18", ">", true},
+		{"created>=2020-01-01", ">=", true},
+		{"1len>5", "", false},
+		{"len>", "", false},
+		{"http://t.co/?a=1", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		operator, ok := HasCompare(c.text)
+		assert.Equal(t, c.ok, ok, c.text)
+		assert.Equal(t, c.operator, operator, c.text)
+	}
+}
+
+// docIDs returns ids of docs in order
+func docIDs(docs []Doc) []uint64 {
+	var ids []uint64
+	for _, doc := range docs {
+		ids = append(ids, doc.DocID)
+	}
+	return ids
+}
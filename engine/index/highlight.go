@@ -0,0 +1,306 @@
+package index
+
+import (
+	"bytes"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultFragmentSize is the number of characters of a highlighted fragment
+	DefaultFragmentSize = 100
+	// DefaultNumberOfFragments is the max number of highlighted fragments of a field
+	DefaultNumberOfFragments = 5
+	// DefaultPreTag and DefaultPostTag mark matched terms
+	DefaultPreTag  = "<em>"
+	DefaultPostTag = "</em>"
+	// EncoderHTML escapes text of fragments to be shown in html, tags are kept as they are
+	EncoderHTML = "html"
+)
+
+// Highlight marks terms of the query matched in string fields of docs, in fragments of text around them
+type Highlight struct {
+	// Fields are string fields to highlight, all fields searched by the query if empty
+	Fields  []string `json:"fields"`
+	PreTag  string   `json:"pre_tag"`
+	PostTag string   `json:"post_tag"`
+	// FragmentSize is the number of characters of a fragment, matched terms longer than it aren't cut
+	FragmentSize int `json:"fragment_size"`
+	// NumberOfFragments is the max number of fragments of a field, fragments with more matched terms are kept
+	NumberOfFragments int `json:"number_of_fragments"`
+	// Encoder is EncoderHTML to escape text, or empty to keep it as it is
+	Encoder string `json:"encoder"`
+}
+
+func (x *Index) checkHighlight(h *Highlight) error {
+	if h == nil {
+		return nil
+	}
+	for _, name := range h.Fields {
+		field, ok := x.Fields[name]
+		if !ok {
+			return errors.Errorf("field %s not found", name)
+		}
+		if field.Type != TString {
+			return errors.Errorf("field %s can't be highlighted, only string fields can", name)
+		}
+	}
+	if h.FragmentSize < 0 {
+		return errors.New("fragment size must not be negative")
+	}
+	if h.NumberOfFragments < 0 {
+		return errors.New("number of fragments must not be negative")
+	}
+	if h.Encoder != "" && h.Encoder != EncoderHTML {
+		return errors.Errorf("unknown encoder %s", h.Encoder)
+	}
+	return nil
+}
+
+// highlight returns highlighted fragments of fields of each doc, fields without matched terms are omitted
+func (x *Index) highlight(root Node, docs []Doc, h *Highlight) []map[string][]string {
+	terms := make(map[string]map[string]bool)
+	x.highlightTerms(root, terms)
+	fields := h.Fields
+	if len(fields) == 0 {
+		for name := range terms {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+	}
+
+	highlights := make([]map[string][]string, len(docs))
+	for i, doc := range docs {
+		highlights[i] = make(map[string][]string)
+		for _, name := range fields {
+			field, ok := x.Fields[name]
+			if !ok || field.Type != TString || len(terms[name]) == 0 {
+				continue
+			}
+			text, _, ok, err := field.getDetail(doc.DocID)
+			if err != nil || !ok {
+				continue
+			}
+			if spans := x.matchSpans(field, doc.DocID, text, terms[name]); len(spans) > 0 {
+				highlights[i][name] = h.fragments(text, spans)
+			}
+		}
+	}
+	return highlights
+}
+
+// highlightTerms collects terms of the query in each field, except terms of excluded clauses
+func (x *Index) highlightTerms(node Node, terms map[string]map[string]bool) {
+	add := func(field string, words []string) {
+		if terms[field] == nil {
+			terms[field] = make(map[string]bool)
+		}
+		for _, word := range words {
+			terms[field][word] = true
+		}
+	}
+	switch n := node.(type) {
+	case *termQuery:
+		for _, f := range x.searchFields(n.field, n.fields) {
+			add(f.name, n.terms)
+		}
+	case *phraseQuery:
+		for _, f := range x.searchFields(n.field, nil) {
+			add(f.name, n.terms)
+		}
+	case *multiTermQuery:
+		for field, words := range n.expansions {
+			add(field, words)
+		}
+	case *boostQuery:
+		x.highlightTerms(n.child, terms)
+	case *constantScoreQuery:
+		x.highlightTerms(n.child, terms)
+	case *functionScoreQuery:
+		x.highlightTerms(n.child, terms)
+	case *optionalQuery:
+		x.highlightTerms(n.required, terms)
+		for _, child := range n.optional {
+			x.highlightTerms(child, terms)
+		}
+	case *boolQuery:
+		for _, child := range n.children {
+			x.highlightTerms(child, terms)
+		}
+	}
+}
+
+// matchSpans returns byte offsets of terms in text of the doc, read from postings if offsets are indexed, or else by
+// analyzing the text again. Spans overlapping or next to each other, e.g. of CJK words split in search mode, are merged.
+func (x *Index) matchSpans(field *Field, docid uint64, text string, terms map[string]bool) [][2]int {
+	var spans [][2]int
+	if field.Offsets && field.invert != nil {
+		for term := range terms {
+			pl, ok := field.invert.searchPostings(term)
+			if !ok {
+				continue
+			}
+			for _, s := range pl.spans(pl.find(docid)) {
+				if s[0] < s[1] && s[1] <= uint64(len(text)) {
+					spans = append(spans, [2]int{int(s[0]), int(s[1])})
+				}
+			}
+		}
+	} else {
+		for _, token := range x.Segmenter.Tokenize(text, true) {
+			if terms[strings.TrimSpace(token.Text)] {
+				spans = append(spans, [2]int{token.Start, token.End})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s[0] <= last[1] {
+			if s[1] > last[1] {
+				last[1] = s[1]
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// fragment is a part of text from start to end containing spans of matched terms
+type fragment struct {
+	start int
+	end   int
+	spans [][2]int
+}
+
+// fragments cuts text into fragments around spans in order of text, with spans marked by tags
+func (h *Highlight) fragments(text string, spans [][2]int) []string {
+	size := h.FragmentSize
+	if size == 0 {
+		size = DefaultFragmentSize
+	}
+	number := h.NumberOfFragments
+	if number == 0 {
+		number = DefaultNumberOfFragments
+	}
+
+	var frags []fragment
+	for i := 0; i < len(spans); {
+		f := fragment{start: spans[i][0], end: spans[i][1]}
+		// grow to size characters around the span, half of the rest before it but not into the last fragment
+		rest := size - utf8.RuneCountInString(text[f.start:f.end])
+		limit := 0
+		if len(frags) > 0 {
+			limit = frags[len(frags)-1].end
+		}
+		var n int
+		f.start, n = backRunes(text, f.start, rest/2, limit)
+		f.end = forwardRunes(text, f.end, rest-n)
+		for i < len(spans) && spans[i][0] < f.end {
+			if spans[i][1] > f.end {
+				f.end = spans[i][1]
+			}
+			f.spans = append(f.spans, spans[i])
+			i++
+		}
+		f.start, f.end = trimFragment(text, f.start, f.end, f.spans[0][0], f.spans[len(f.spans)-1][1])
+		frags = append(frags, f)
+	}
+	if len(frags) > number {
+		sort.SliceStable(frags, func(i, j int) bool { return len(frags[i].spans) > len(frags[j].spans) })
+		frags = frags[:number]
+		sort.Slice(frags, func(i, j int) bool { return frags[i].start < frags[j].start })
+	}
+
+	pre, post := h.PreTag, h.PostTag
+	if pre == "" && post == "" {
+		pre, post = DefaultPreTag, DefaultPostTag
+	}
+	encode := func(s string) string { return s }
+	if h.Encoder == EncoderHTML {
+		encode = html.EscapeString
+	}
+	result := make([]string, len(frags))
+	for i, f := range frags {
+		var b bytes.Buffer
+		pos := f.start
+		for _, s := range f.spans {
+			b.WriteString(encode(text[pos:s[0]]))
+			b.WriteString(pre)
+			b.WriteString(encode(text[s[0]:s[1]]))
+			b.WriteString(post)
+			pos = s[1]
+		}
+		b.WriteString(encode(text[pos:f.end]))
+		result[i] = b.String()
+	}
+	return result
+}
+
+// backRunes moves pos back by n characters but not before limit, returns the new pos and characters moved
+func backRunes(text string, pos, n, limit int) (int, int) {
+	moved := 0
+	for ; moved < n && pos > limit; moved++ {
+		_, w := utf8.DecodeLastRuneInString(text[:pos])
+		pos -= w
+	}
+	return pos, moved
+}
+
+// forwardRunes moves pos forward by n characters but not past the end of text
+func forwardRunes(text string, pos, n int) int {
+	for i := 0; i < n && pos < len(text); i++ {
+		_, w := utf8.DecodeRuneInString(text[pos:])
+		pos += w
+	}
+	return pos
+}
+
+// trimFragment drops words cut at both ends of the fragment and spaces around it, without dropping any span from
+// first to last. Words of CJK text aren't separated by spaces, their characters are never dropped.
+func trimFragment(text string, start, end, first, last int) (int, int) {
+	prev := ' '
+	if start > 0 {
+		prev, _ = utf8.DecodeLastRuneInString(text[:start])
+	}
+	for start < first {
+		r, w := utf8.DecodeRuneInString(text[start:])
+		if !unicode.IsSpace(r) && !(inWord(prev) && inWord(r)) {
+			break
+		}
+		prev = r
+		start += w
+	}
+	next := ' '
+	if end < len(text) {
+		next, _ = utf8.DecodeRuneInString(text[end:])
+	}
+	for end > last {
+		r, w := utf8.DecodeLastRuneInString(text[:end])
+		if !unicode.IsSpace(r) && !(inWord(r) && inWord(next)) {
+			break
+		}
+		next = r
+		end -= w
+	}
+	return start, end
+}
+
+// inWord tells if the character is in a word of text separated by spaces, e.g. latin letters
+func inWord(r rune) bool {
+	if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
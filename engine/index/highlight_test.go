@@ -0,0 +1,78 @@
+package index
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight_fragments(t *testing.T) {
+	text := "tom brady and the patriots won the super bowl in houston, and then they won the super bowl again"
+	spans := [][2]int{{0, 3}, {35, 40}, {41, 45}, {80, 85}, {86, 90}}
+	h := &Highlight{FragmentSize: 20}
+	assert.Equal(t, []string{"<em>tom</em> brady and the", "the <em>super</em> <em>bowl</em> in",
+		"the <em>super</em> <em>bowl</em>"}, h.fragments(text, spans))
+	h = &Highlight{FragmentSize: 20, NumberOfFragments: 2, PreTag: "[", PostTag: "]"}
+	assert.Equal(t, []string{"the [super] [bowl] in", "the [super] [bowl]"}, h.fragments(text, spans))
+	h = &Highlight{FragmentSize: 1000}
+	assert.Equal(t, []string{"<em>tom</em> brady and the patriots won the <em>super</em> <em>bowl</em> in houston, " +
+		"and then they won the <em>super</em> <em>bowl</em> again"}, h.fragments(text, spans))
+
+	h = &Highlight{Encoder: EncoderHTML}
+	assert.Equal(t, []string{"<em>a&lt;b</em> &amp; c"}, h.fragments("a<b & c", [][2]int{{0, 3}}))
+
+	// CJK text is cut between characters as words aren't separated by spaces
+	text = "汤姆布雷迪和爱国者队赢得了超级碗的冠军"
+	h = &Highlight{FragmentSize: 7}
+	assert.Equal(t, []string{"得了<em>超级碗</em>的冠"}, h.fragments(text, [][2]int{{39, 48}}))
+}
+
+func TestIndex_SearchWithOptions_Highlight(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(map[string]uint64{"title": TString, "text": TString, "author": TKeyword}))
+	assert.Nil(t, index.SetOffsets("text", true))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "Super Bowl LII", "author": "tom",
+		"text": "Tom Brady lost the Super Bowl to the Eagles, Nick Foles was the MVP of the game"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "超级碗", "text": "老鹰队赢得了超级碗的冠军"}))
+	assert.Nil(t, index.SyncToDisk())
+
+	// offsets of text are indexed while title is analyzed again
+	result, err := index.SearchWithOptions("bowl OR title:super OR author:tom", SearchOptions{
+		Highlight: &Highlight{FragmentSize: 30}})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0}, docIDs(result.Docs))
+	assert.Equal(t, []map[string][]string{{
+		"title": {"<em>Super</em> <em>Bowl</em> LII"},
+		"text":  {"the Super <em>Bowl</em> to the"},
+	}}, result.Highlights)
+
+	result, err = index.SearchWithOptions("超级碗 OR 老鹰", SearchOptions{Highlight: &Highlight{}})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1}, docIDs(result.Docs))
+	assert.Equal(t, []map[string][]string{{"title": {"<em>超级碗</em>"}, "text": {"<em>老鹰</em>队赢得了<em>超级碗</em>的冠军"}}},
+		result.Highlights)
+	result, err = index.SearchWithOptions("超级碗", SearchOptions{Highlight: &Highlight{Fields: []string{"text"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string][]string{{"text": {"老鹰队赢得了<em>超级碗</em>的冠军"}}}, result.Highlights)
+
+	// terms of excluded clauses aren't highlighted
+	var req SearchRequest
+	assert.Nil(t, json.Unmarshal([]byte(`{"query": {"bool": {"must": [{"match": {"text": "brady"}}],
+		"must_not": [{"match": {"text": "patriots"}}], "should": [{"phrase": {"text": "nick foles"}}]}},
+		"highlight": {"fields": ["text"], "pre_tag": "<b>", "post_tag": "</b>", "fragment_size": 20}}`), &req))
+	result, err = index.SearchDSL(&req)
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string][]string{{"text": {"Tom <b>Brady</b> lost the", "Eagles, <b>Nick</b> <b>Foles</b>"}}},
+		result.Highlights)
+
+	for _, h := range []*Highlight{{Fields: []string{"none"}}, {Fields: []string{"author"}}, {FragmentSize: -1},
+		{NumberOfFragments: -1}, {Encoder: "xml"}} {
+		_, err = index.SearchWithOptions("bowl", SearchOptions{Highlight: h})
+		assert.NotNil(t, err, h)
+	}
+}
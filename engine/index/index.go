@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/cosmtrek/violet/pkg/analyzer"
 	"github.com/cosmtrek/violet/pkg/utils"
@@ -18,6 +19,14 @@ const (
 	TNumber
 	// TStore store type
 	TStore
+	// TGeo geo point type, value is in form of "lat,lon"
+	TGeo
+	// TIP ip address type, both IPv4 and IPv6
+	TIP
+	// TDate date type, stored as unix seconds
+	TDate
+	// TKeyword keyword type, the whole value is a term matched exactly, e.g. author or url, and sorted by doc values
+	TKeyword
 )
 
 // Index is the entry to all low level data structures
@@ -26,18 +35,37 @@ type Index struct {
 	MaxDocID  uint64            `json:"maxdocid"`
 	Path      string            `json:"path"`
 	FieldMeta map[string]uint64 `json:"fields"`
-	Fields    map[string]*Field
-	Segmenter analyzer.Analyzer
+	// DefaultOperator combines clauses without operator, "AND" by default or "OR"
+	DefaultOperator string `json:"default_operator"`
+	// MaxExpansions limits terms a wildcard query expands to
+	MaxExpansions int `json:"max_expansions"`
+	// DefaultFields are string fields searched for words without field, all string fields if empty
+	DefaultFields []string `json:"default_fields"`
+	// MultiFieldMode is how words of a query match across default fields, "cross_fields" by default or "best_fields"
+	MultiFieldMode string `json:"multi_field_mode"`
+	// AllowRegexpScan allows regexps without literal prefix which match against every term
+	AllowRegexpScan bool `json:"allow_regexp_scan"`
+	Fields          map[string]*Field
+	Segmenter       analyzer.Analyzer
+	// Percolated is called with ids of registered queries that an added document matches
+	Percolated func(docid uint64, ids []string) `json:"-"`
+	percolator *Percolator
+	// lock is held for reading by searches and reads of documents, and for writing while documents or fields are
+	// added and while the index is synced to disk, which replaces merged idx files and grows mapped files
+	lock sync.RWMutex
 }
 
 // NewIndex initializes index
 func NewIndex(path string, name string, segmenter analyzer.Analyzer) (*Index, error) {
 	index := &Index{
-		Name:      name,
-		Path:      path,
-		FieldMeta: nil,
-		Segmenter: segmenter,
-		Fields:    make(map[string]*Field),
+		Name:            name,
+		Path:            path,
+		FieldMeta:       nil,
+		DefaultOperator: OperatorAnd,
+		MaxExpansions:   DefaultMaxExpansions,
+		MultiFieldMode:  ModeCrossFields,
+		Segmenter:       segmenter,
+		Fields:          make(map[string]*Field),
 	}
 	metafile := indexMetaFile(path, name)
 	if utils.FileExists(metafile) {
@@ -48,14 +76,16 @@ func NewIndex(path string, name string, segmenter analyzer.Analyzer) (*Index, er
 		if err = json.Unmarshal(meta, index); err != nil {
 			return nil, errors.Wrap(err, "failed to unmarshal meta into index")
 		}
-		fieldPath := fmt.Sprintf("%v/%v_", path, name)
 		for fname, ftype := range index.FieldMeta {
-			field, err := NewField(fname, ftype, fieldPath, segmenter)
+			field, err := index.newField(fname, ftype)
 			if err != nil {
 				return nil, errors.Wrap(err, "failed to load field file")
 			}
 			index.Fields[fname] = field
 		}
+		if index.percolator, err = loadPercolator(index); err != nil {
+			return nil, errors.Wrap(err, "failed to load percolator")
+		}
 	} else {
 		// TODO
 	}
@@ -64,51 +94,179 @@ func NewIndex(path string, name string, segmenter analyzer.Analyzer) (*Index, er
 
 // IndexFields documents field's meta info
 func (x *Index) IndexFields(fields map[string]uint64) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return x.indexFields(fields)
+}
+
+func (x *Index) indexFields(fields map[string]uint64) error {
 	if x.FieldMeta == nil {
 		x.FieldMeta = fields
-		fieldPath := fmt.Sprintf("%v/%v_", x.Path, x.Name)
 		for fname, ftype := range fields {
-			field, err := NewField(fname, ftype, fieldPath, x.Segmenter)
+			field, err := x.newField(fname, ftype)
 			if err != nil {
 				return errors.Wrap(err, "failed to create field file")
 			}
 			x.Fields[fname] = field
 		}
+		// queries are parsed by fields, saved ones are reloaded once fields are known
+		percolator, err := loadPercolator(x)
+		if err != nil {
+			return errors.Wrap(err, "failed to load percolator")
+		}
+		x.percolator = percolator
 		return nil
 	}
 	return errors.New("fields existed")
 }
 
-// AddDocument inserts documents to index
+// AddFields adds new fields to an index that may already hold documents,
+// documents indexed before are treated as missing for the new fields
+func (x *Index) AddFields(fields map[string]uint64) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if x.FieldMeta == nil {
+		return x.indexFields(fields)
+	}
+	for fname := range fields {
+		if _, ok := x.FieldMeta[fname]; ok {
+			return errors.Errorf("field %s existed", fname)
+		}
+	}
+	// meta of new fields is saved before they are added, so they start at the same docid after a restart
+	added := make(map[string]*Field, len(fields))
+	for fname, ftype := range fields {
+		field, err := x.newField(fname, ftype)
+		if err != nil {
+			return errors.Wrap(err, "failed to create field file")
+		}
+		field.setBaseDocID(x.MaxDocID)
+		if err = field.saveMeta(); err != nil {
+			return err
+		}
+		added[fname] = field
+	}
+	for fname, field := range added {
+		x.FieldMeta[fname] = field.Type
+		x.Fields[fname] = field
+	}
+	return nil
+}
+
+// newField opens the field of index
+func (x *Index) newField(name string, ftype uint64) (*Field, error) {
+	return NewField(name, ftype, fmt.Sprintf("%v/%v_", x.Path, x.Name), x.Segmenter)
+}
+
+// DeprecateField stops indexing the field for new documents, old documents are still searchable
+func (x *Index) DeprecateField(name string) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	field, ok := x.Fields[name]
+	if !ok {
+		return errors.Errorf("field %s not found", name)
+	}
+	// the flag is saved before it's set, so the field isn't indexed again after a restart
+	meta := *field
+	meta.Deprecated = true
+	if err := meta.saveMeta(); err != nil {
+		return err
+	}
+	field.Deprecated = true
+	return nil
+}
+
+// SetOffsets makes the field index byte offsets of terms, it must be set before adding documents
+func (x *Index) SetOffsets(name string, offsets bool) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	field, ok := x.Fields[name]
+	if !ok {
+		return errors.Errorf("field %s not found", name)
+	}
+	if field.invert == nil {
+		return errors.Errorf("field %s is not indexed", name)
+	}
+	if x.MaxDocID > 0 {
+		return errors.New("offsets must be set before adding documents")
+	}
+	field.Offsets = offsets
+	field.invert.offsets = offsets
+	return nil
+}
+
+// AddDocument inserts documents to index, Percolated is called after the index is unlocked
 func (x *Index) AddDocument(doc map[string]string) error {
+	docid, ids, err := x.addDocument(doc)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		x.Percolated(docid, ids)
+	}
+	return nil
+}
+
+// addDocument adds the document with index locked, returns ids of queries it matches if Percolated is set
+func (x *Index) addDocument(doc map[string]string) (uint64, []string, error) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
 	if x.FieldMeta == nil {
-		return errors.New("no field meta")
+		return 0, nil, errors.New("no field meta")
 	}
 	docid := x.MaxDocID
 	x.MaxDocID++
 	for name, field := range x.Fields {
-		if _, ok := doc[name]; !ok {
-			doc[name] = ""
+		if field.Deprecated {
+			continue
 		}
+		// missing fields are recorded as absent by field
 		if err := field.addDocument(docid, doc[name]); err != nil {
 			x.MaxDocID--
-			return err
+			return 0, nil, err
 		}
 	}
-	return nil
+	var ids []string
+	if x.Percolated != nil {
+		ids = x.percolate(doc)
+	}
+	return docid, ids, nil
 }
 
 // Search query and returns docs
 func (x *Index) Search(query string) ([]Doc, bool) {
+	docs, err := x.SearchQuery(query)
+	return docs, err == nil && len(docs) > 0
+}
+
+// SearchQuery returns docs matching query ranked by score, the error is a *ParseError if query is invalid
+func (x *Index) SearchQuery(query string) ([]Doc, error) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
 	q, err := NewQuery(x, query)
 	if err != nil {
-		return nil, false
+		return nil, errors.Cause(err)
 	}
-	return q.do()
+	docs, _ := q.do()
+	return docs, nil
+}
+
+// ValidateQuery parses query without searching, returns a *ParseError with the position and reason if it's invalid
+func (x *Index) ValidateQuery(query string) error {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	_, err := NewQuery(x, query)
+	return errors.Cause(err)
 }
 
 // SearchTerm returns docs that contains term
 func (x *Index) SearchTerm(term, field string) ([]Doc, bool) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	return x.searchTerm(term, field)
+}
+
+func (x *Index) searchTerm(term, field string) ([]Doc, bool) {
 	t := strings.TrimSpace(term)
 	if len(t) <= 0 {
 		return nil, false
@@ -116,21 +274,54 @@ func (x *Index) SearchTerm(term, field string) ([]Doc, bool) {
 	return x.Fields[field].searchTerm(term)
 }
 
+// ExistDocs returns docs that have a value for the field
+func (x *Index) ExistDocs(field string) ([]Doc, bool) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	return x.existDocs(field)
+}
+
+func (x *Index) existDocs(field string) ([]Doc, bool) {
+	f, ok := x.Fields[field]
+	if !ok {
+		return nil, false
+	}
+	docs := f.existDocs()
+	return docs, len(docs) > 0
+}
+
+// allDocs returns all docs in index
+func (x *Index) allDocs() []Doc {
+	docs := make([]Doc, x.MaxDocID)
+	for i := range docs {
+		docs[i].DocID = uint64(i)
+	}
+	return docs
+}
+
 // GetDocument returns document source
 func (x *Index) GetDocument(docid uint64) (map[string]string, bool) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
 	if docid > x.MaxDocID {
 		return nil, false
 	}
 	doc := make(map[string]string)
 	for fname, field := range x.Fields {
-		v, _, ok, err := field.getDetail(docid)
+		v, num, ok, err := field.getDetail(docid)
 		if err != nil {
 			return nil, false
 		}
-		if ok {
-			doc[fname] = v
+		// omit fields that the document lacks
+		if !ok {
+			continue
+		}
+		if field.Type == TNumber {
+			doc[fname] = strconv.FormatUint(num, 10)
+		} else if field.Type == TDate {
+			doc[fname] = formatDate(num)
 		} else {
-			doc[fname] = ""
+			doc[fname] = v
 		}
 	}
 	doc["docid"] = strconv.Itoa(int(docid))
@@ -139,6 +330,8 @@ func (x *Index) GetDocument(docid uint64) (map[string]string, bool) {
 
 // SyncToDisk flushes documents into disk
 func (x *Index) SyncToDisk() error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
 	if x.FieldMeta == nil {
 		return errors.New("no field meta")
 	}
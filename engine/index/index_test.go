@@ -1,6 +1,7 @@
 package index
 
 import (
+	"fmt"
 	"strconv"
 	"testing"
 
@@ -75,8 +76,201 @@ func TestIndex_IndexFields_AddDocument_Search_GetDocument(t *testing.T) {
 	assert.Nil(t, err)
 	docs1, found1 := index.Search("我们之间留了太多空白格 b>10")
 	assert.True(t, found1)
-	expected1 := []Doc{{DocID: 9}, {DocID: 23}, {DocID: 31}}
-	assert.EqualValues(t, expected1, docs1)
+	assert.Equal(t, []uint64{9, 23, 31}, docIDs(docs1))
 	_, found2 := index.Search("我们之间留了太多空白格 b>50")
 	assert.False(t, found2)
 }
+
+func TestIndex_AddFields_DeprecateField(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	err = index.IndexFields(map[string]uint64{"a": TString})
+	assert.Nil(t, err)
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "patriots win super bowl"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "falcons lose super bowl"}))
+	assert.Nil(t, index.SyncToDisk())
+
+	err = index.AddFields(map[string]uint64{"a": TString})
+	assert.NotNil(t, err)
+	err = index.AddFields(map[string]uint64{"b": TString, "c": TNumber})
+	assert.Nil(t, err)
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "brady super bowl", "b": "tom brady", "c": "39"}))
+	assert.Nil(t, index.SyncToDisk())
+
+	docs1, found1 := index.Search("super")
+	assert.True(t, found1)
+	assert.Equal(t, []uint64{2, 0, 1}, docIDs(docs1))
+	docs2, found2 := index.Search("b:brady")
+	assert.True(t, found2)
+	assert.Equal(t, []uint64{2}, docIDs(docs2))
+	docs3, found3 := index.Search("bowl c>30")
+	assert.True(t, found3)
+	assert.Equal(t, []uint64{2}, docIDs(docs3))
+	doc0, ok := index.GetDocument(0)
+	assert.True(t, ok)
+	assert.Equal(t, "", doc0["b"])
+	doc2, ok := index.GetDocument(2)
+	assert.True(t, ok)
+	assert.Equal(t, "tom brady", doc2["b"])
+
+	assert.NotNil(t, index.DeprecateField("d"))
+	assert.Nil(t, index.DeprecateField("b"))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "eagles", "b": "nick foles"}))
+	assert.Nil(t, index.SyncToDisk())
+	_, found4 := index.Search("b:foles")
+	assert.False(t, found4)
+	docs5, found5 := index.Search("b:brady")
+	assert.True(t, found5)
+	assert.Equal(t, []uint64{2}, docIDs(docs5))
+}
+
+func TestIndex_MissingValues_ExistsQuery(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	err = index.IndexFields(map[string]uint64{"a": TString, "b": TNumber})
+	assert.Nil(t, err)
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "super bowl", "b": "0"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "super bowl"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"b": "51"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "super bowl", "b": ""}))
+	assert.Nil(t, index.SyncToDisk())
+
+	doc0, ok := index.GetDocument(0)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"docid": "0", "a": "super bowl", "b": "0"}, doc0)
+	doc1, ok := index.GetDocument(1)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"docid": "1", "a": "super bowl"}, doc1)
+	doc2, ok := index.GetDocument(2)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"docid": "2", "b": "51"}, doc2)
+
+	docs1, found1 := index.Search("_exists_:b")
+	assert.True(t, found1)
+	assert.EqualValues(t, []Doc{{DocID: 0}, {DocID: 2}}, docs1)
+	docs2, found2 := index.Search("super -_exists_:b")
+	assert.True(t, found2)
+	assert.Equal(t, []uint64{1, 3}, docIDs(docs2))
+	docs3, found3 := index.Search("-_exists_:a")
+	assert.True(t, found3)
+	assert.EqualValues(t, []Doc{{DocID: 2}}, docs3)
+	docs4, found4 := index.Search("super b<10")
+	assert.True(t, found4)
+	assert.Equal(t, []uint64{0}, docIDs(docs4))
+}
+
+func TestIndex_SearchWhileSyncToDisk(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(map[string]uint64{"a": TString}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "hello world"}))
+	assert.Nil(t, index.SyncToDisk())
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			// every sync merges the idx file with a new segment and replaces it
+			if !assert.Nil(t, index.Fields["a"].invert.addTerms(uint64(i+1), []string{"hello"})) ||
+				!assert.Nil(t, index.SyncToDisk()) {
+				return
+			}
+		}
+	}()
+	for searching := true; searching; {
+		select {
+		case <-done:
+			searching = false
+		default:
+		}
+		docs, err := index.SearchQuery("a:hello")
+		assert.Nil(t, err)
+		assert.NotEmpty(t, docs)
+	}
+}
+
+func TestIndex_AddDocumentWhileSearching(t *testing.T) {
+	index := newTestIndex(t, map[string]uint64{"a": TString, "b": TNumber},
+		map[string]string{"a": "hello world", "b": "1"})
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if !assert.Nil(t, index.AddDocument(map[string]string{"a": "hello again", "b": strconv.Itoa(i)})) {
+				return
+			}
+			if i%10 == 9 && !assert.Nil(t, index.SyncToDisk()) {
+				return
+			}
+		}
+	}()
+	for searching := true; searching; {
+		select {
+		case <-done:
+			searching = false
+		default:
+		}
+		docs, err := index.SearchQuery("hello b>0")
+		assert.Nil(t, err)
+		assert.NotEmpty(t, docs)
+		_, ok := index.GetDocument(docs[0].DocID)
+		assert.True(t, ok)
+	}
+	docs, err := index.SearchQuery("again")
+	assert.Nil(t, err)
+	assert.Equal(t, 50, len(docs))
+}
+
+func TestIndex_AddFieldsWhileSearching(t *testing.T) {
+	index := newTestIndex(t, map[string]uint64{"a": TString}, map[string]string{"a": "hello world"})
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			name := "f" + strconv.Itoa(i)
+			if !assert.Nil(t, index.AddFields(map[string]uint64{name: TString})) ||
+				!assert.Nil(t, index.DeprecateField(name)) {
+				return
+			}
+		}
+	}()
+	for searching := true; searching; {
+		select {
+		case <-done:
+			searching = false
+		default:
+		}
+		// words without field are searched in all string fields
+		docs, err := index.SearchQuery("hello")
+		assert.Nil(t, err)
+		assert.Equal(t, []uint64{0}, docIDs(docs))
+		assert.Nil(t, index.AddDocument(map[string]string{"a": "bye"}))
+	}
+	assert.True(t, index.Fields["f19"].Deprecated)
+}
+
+func TestIndex_AddFields_DeprecateField_Reopen(t *testing.T) {
+	index := newTestIndex(t, map[string]uint64{"a": TString},
+		map[string]string{"a": "patriots win super bowl"}, map[string]string{"a": "falcons lose super bowl"})
+	assert.Nil(t, index.AddFields(map[string]uint64{"b": TString}))
+	assert.Nil(t, index.DeprecateField("a"))
+
+	// meta of fields is saved without syncing the index
+	fieldPath := fmt.Sprintf("%v/%v_", index.Path, index.Name)
+	a, err := NewField("a", TString, fieldPath, segmenter())
+	assert.Nil(t, err)
+	assert.True(t, a.Deprecated)
+	b, err := NewField("b", TString, fieldPath, segmenter())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), b.BaseDocID)
+	assert.Equal(t, uint64(2), b.MaxDocID)
+	assert.False(t, b.exists(0))
+}
@@ -2,10 +2,10 @@ package index
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"sort"
@@ -23,8 +23,13 @@ import (
 const (
 	// InvertSyncInterval save invert files at intervals
 	InvertSyncInterval = 100000
+	// PostingBlockSize is the number of docs in a block of a posting list which keeps the max impact of them
+	PostingBlockSize = 64
 )
 
+// mergingSuffix is the suffix of idx and dic files being merged before they replace the old ones
+const mergingSuffix = ".merging"
+
 // Invert is the core of search engine
 type Invert struct {
 	curDocID   uint64
@@ -33,15 +38,28 @@ type Invert struct {
 	filepath   string
 	tmpIvts    []tmpIvt
 	idx        *io.Mmap
-	terms      skeleton.KV
+	terms      *skeleton.TermDict
 	segmentNum uint64
 	segmenter  analyzer.Analyzer
 	wg         *sync.WaitGroup
+	// offsets makes byte offsets of terms stored with positions
+	offsets bool
+	// norms are lengths of the field in documents, which impacts of postings read back from idx file are made of
+	norms *skeleton.Norms
 }
 
 type tmpMergeTable struct {
-	Term string
-	Docs []Doc
+	Term     string
+	Postings []posting
+}
+
+// posting is a doc containing the term, offsets are pairs of start and end of each position,
+// length is the number of terms in the field of the doc
+type posting struct {
+	DocID     uint64
+	Positions []uint64
+	Offsets   []uint64
+	Length    uint32
 }
 
 // NewInvert initializes invert struct
@@ -56,10 +74,10 @@ func NewInvert(filepath string, field string, fieldtype uint64, segmenter analyz
 	var err error
 	idxfile := idxFile(filepath, field)
 	dicfile := dicFile(filepath, field)
-	ivt.terms = skeleton.NewHashMap()
+	ivt.terms = skeleton.NewTermDict()
 	if utils.FileExists(idxfile) && utils.FileExists(dicfile) {
-		if err = ivt.terms.Load(idxfile); err != nil {
-			return nil, errors.Wrap(err, "failed to load idx file")
+		if err = ivt.terms.Load(dicfile); err != nil {
+			return nil, errors.Wrap(err, "failed to load dic file")
 		}
 		idx, err := io.NewMmap(idxfile, io.ModeAppend)
 		if err != nil {
@@ -73,33 +91,60 @@ func NewInvert(filepath string, field string, fieldtype uint64, segmenter analyz
 		}
 		ivt.idx = idx
 	}
+	// segments left unmerged, e.g. by a crash, are merged by the next merge
+	for utils.FileExists(ivtFile(filepath, field, ivt.segmentNum)) {
+		ivt.segmentNum++
+	}
 
 	return ivt, nil
 }
 
-func (v *Invert) addDocument(docid uint64, content string) error {
-	terms := v.segmenter.Analyze(content, true)
+// addDocument adds terms of content, returns the number of terms which is the length of the field in the document
+func (v *Invert) addDocument(docid uint64, content string) (uint32, error) {
+	// one tmpIvt for each term of the document, which collects all positions of the term
+	ivts := make(map[string]int)
+	var length uint32
+	for _, token := range v.segmenter.Tokenize(content, true) {
+		t := strings.TrimSpace(token.Text)
+		if len(t) == 0 {
+			continue
+		}
+		length++
+		i, ok := ivts[t]
+		if !ok {
+			v.tmpIvts = append(v.tmpIvts, tmpIvt{DocID: docid, Term: t})
+			i = len(v.tmpIvts) - 1
+			ivts[t] = i
+		}
+		ivt := &v.tmpIvts[i]
+		ivt.Positions = append(ivt.Positions, uint64(token.Position))
+		if v.offsets {
+			ivt.Offsets = append(ivt.Offsets, uint64(token.Start), uint64(token.End))
+		}
+	}
+	// lengths bound scores of docs in blocks of posting lists
+	for _, i := range ivts {
+		v.tmpIvts[i].Length = length
+	}
+	return length, nil
+}
+
+// addTerms adds terms that are not produced by segmenter, e.g. geohash cells, they have no positions
+func (v *Invert) addTerms(docid uint64, terms []string) error {
+	// prevent duplicated tmpIvt
+	found := make(map[string]bool)
 	for _, term := range terms {
 		t := strings.TrimSpace(term)
-		if len(t) > 0 {
-			// prevent duplicated tmpIvt
-			found := false
-			for _, e := range v.tmpIvts {
-				if e.Term == t && e.DocID == docid {
-					found = true
-					break
-				}
-			}
-			if !found {
-				v.tmpIvts = append(v.tmpIvts, tmpIvt{DocID: docid, Term: t})
-			}
+		if len(t) > 0 && !found[t] {
+			found[t] = true
+			v.tmpIvts = append(v.tmpIvts, tmpIvt{DocID: docid, Term: t})
 		}
 	}
 	return nil
 }
 
 func (v *Invert) saveTmpInvert() error {
-	file := fmt.Sprintf("%v%v_%v.ivt", v.filepath, v.field, v.segmentNum)
+	file := ivtFile(v.filepath, v.field, v.segmentNum)
 	v.segmentNum++
 	sort.Sort(TmpIvtTermSort(v.tmpIvts))
 
@@ -120,23 +165,77 @@ func (v *Invert) saveTmpInvert() error {
 	return nil
 }
 
+// mergeTmpInvert merges postings of the idx file and of segments saved since the last merge into new idx and dic
+// files replacing the old ones, merged segments are removed. Postings of the idx file aren't read from segments again.
 func (v *Invert) mergeTmpInvert() error {
-	var tableChans []chan tmpMergeTable
+	var segments []string
 	for i := uint64(0); i < v.segmentNum; i++ {
-		file := ivtFile(v.filepath, v.field, i)
-		tableChans = append(tableChans, make(chan tmpMergeTable))
+		if file := ivtFile(v.filepath, v.field, i); utils.FileExists(file) {
+			segments = append(segments, file)
+		}
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	var tableChans []chan tmpMergeTable
+	if v.terms.Len() > 0 {
+		tableChan := make(chan tmpMergeTable)
+		tableChans = append(tableChans, tableChan)
 		v.wg.Add(1)
-		go v.mapRoutine(file, &tableChans[i])
+		go v.idxRoutine(tableChan)
+	}
+	for _, file := range segments {
+		tableChan := make(chan tmpMergeTable)
+		tableChans = append(tableChans, tableChan)
+		v.wg.Add(1)
+		go v.mapRoutine(file, tableChan)
+	}
+	err := v.reduceRoutine(tableChans)
+	// drain tables left by a failed reduce so that routines can finish
+	for _, tableChan := range tableChans {
+		for range tableChan {
+		}
 	}
-	v.wg.Add(1)
-	file := ivtFile(v.filepath, v.field, v.segmentNum)
-	go v.reduceRoutine(file, &tableChans)
 	v.wg.Wait()
+	if err != nil {
+		return err
+	}
+	for _, file := range segments {
+		if err = os.Remove(file); err != nil {
+			return errors.Wrap(err, "failed to remove merged segment")
+		}
+	}
+	v.segmentNum = 0
 	return nil
 }
 
-func (v *Invert) mapRoutine(file string, tableChan *chan tmpMergeTable) error {
+// idxRoutine reads postings of terms in the idx file, in the same descending order of terms as segments
+func (v *Invert) idxRoutine(tableChan chan tmpMergeTable) {
+	defer v.wg.Done()
+	defer close(tableChan)
+
+	for i := v.terms.Len() - 1; i >= 0; i-- {
+		term, offset := v.terms.Term(i)
+		pl := v.postingsAt(offset)
+		table := tmpMergeTable{Term: term, Postings: make([]posting, len(pl.docs))}
+		for j, doc := range pl.docs {
+			p := posting{DocID: doc.DocID, Positions: pl.positions(j)}
+			for _, span := range pl.spans(j) {
+				p.Offsets = append(p.Offsets, span[0], span[1])
+			}
+			if v.norms != nil {
+				p.Length = v.norms.Get(doc.DocID)
+			}
+			table.Postings[j] = p
+		}
+		tableChan <- table
+	}
+}
+
+func (v *Invert) mapRoutine(file string, tableChan chan tmpMergeTable) error {
 	defer v.wg.Done()
+	defer close(tableChan)
 
 	fd, err := os.Open(file)
 	if err != nil {
@@ -146,63 +245,49 @@ func (v *Invert) mapRoutine(file string, tableChan *chan tmpMergeTable) error {
 
 	scanner := bufio.NewScanner(fd)
 	var table tmpMergeTable
-	if scanner.Scan() {
-		var ivt tmpIvt
-		content := scanner.Text()
-		json.Unmarshal([]byte(content), &ivt)
-		table.Term = ivt.Term
-		table.Docs = make([]Doc, 0)
-		table.Docs = append(table.Docs, Doc{DocID: ivt.DocID})
-	}
 	for scanner.Scan() {
 		var ivt tmpIvt
 		content := scanner.Text()
 		json.Unmarshal([]byte(content), &ivt)
-		if ivt.Term == table.Term {
-			table.Docs = append(table.Docs, Doc{DocID: ivt.DocID})
-		} else {
-			*tableChan <- table
-			table.Term = ivt.Term
-			table.Docs = make([]Doc, 0)
-			table.Docs = append(table.Docs, Doc{DocID: ivt.DocID})
+		if len(table.Postings) > 0 && ivt.Term != table.Term {
+			tableChan <- table
+			table = tmpMergeTable{}
 		}
+		table.Term = ivt.Term
+		table.Postings = append(table.Postings, ivt.posting())
+	}
+	if len(table.Postings) > 0 {
+		tableChan <- table
 	}
-	*tableChan <- table
-	close(*tableChan)
-	os.Remove(file)
 	return nil
 }
 
-func (v *Invert) reduceRoutine(file string, tableChans *[]chan tmpMergeTable) error {
-	defer v.wg.Done()
-
+// reduceRoutine merges tables of the same term from all routines, it writes new idx and dic files besides the old
+// ones which are still read, then replaces them
+func (v *Invert) reduceRoutine(tableChans []chan tmpMergeTable) error {
 	idxfile := idxFile(v.filepath, v.field)
-	idxFd, err := os.OpenFile(idxfile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	idxFd, err := os.OpenFile(idxfile+mergingSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return errors.Wrap(err, "failed to open idx file in reduceRoutine")
 	}
 	defer idxFd.Close()
+	writer := bufio.NewWriter(idxFd)
 
-	dicfile := dicFile(v.filepath, v.field)
-	dicFd, err := os.OpenFile(dicfile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return errors.Wrap(err, "failed to open dic file in reduceRoutine")
-	}
-	defer dicFd.Close()
-
-	tableLens := len(*tableChans)
+	tableLens := len(tableChans)
 	closeFlag := make([]bool, tableLens)
 	var tables []tmpMergeTable
-	v.terms = skeleton.NewHashMap()
+	terms := skeleton.NewTermDict()
 	var maxTerm string
 	var offsetTotal uint64
 
-	for i, t := range *tableChans {
+	openNum := 0
+	for i, t := range tableChans {
 		tt, ok := <-t
 		if ok {
-			if maxTerm < tt.Term {
+			if openNum == 0 || maxTerm < tt.Term {
 				maxTerm = tt.Term
 			}
+			openNum++
 		} else {
 			closeFlag[i] = true
 		}
@@ -210,54 +295,69 @@ func (v *Invert) reduceRoutine(file string, tableChans *[]chan tmpMergeTable) er
 	}
 
 	var nextMax string
-	for {
+	for openNum > 0 {
 		var restable tmpMergeTable
-		restable.Docs = make([]Doc, 0)
+		restable.Postings = make([]posting, 0)
 		restable.Term = maxTerm
 		closeNum := 0
 		for i := range tables {
-			if maxTerm == tables[i].Term {
-				restable.Docs = append(restable.Docs, tables[i].Docs...)
-				tt, ok := <-(*tableChans)[i]
+			if !closeFlag[i] && maxTerm == tables[i].Term {
+				restable.Postings = append(restable.Postings, tables[i].Postings...)
+				tt, ok := <-tableChans[i]
 				if ok {
 					tables[i].Term = tt.Term
-					tables[i].Docs = tt.Docs
+					tables[i].Postings = tt.Postings
 				} else {
 					closeFlag[i] = true
 				}
 			}
 			if !closeFlag[i] {
-				if nextMax <= tables[i].Term {
+				if closeNum == 0 || nextMax <= tables[i].Term {
 					nextMax = tables[i].Term
 				}
 				closeNum++
 			}
 		}
-		sort.Sort(DocSort(restable.Docs))
-		docsLen := uint64(len(restable.Docs))
-		lenBuf := make([]byte, 8)
-		binary.LittleEndian.PutUint64(lenBuf, docsLen)
-		idxFd.Write(lenBuf)
-
-		buf := new(bytes.Buffer)
-		if err = binary.Write(buf, binary.LittleEndian, restable.Docs); err != nil {
+		sort.Sort(PostingSort(restable.Postings))
+		data := encodePostings(restable.Postings, v.offsets)
+		if err = binary.Write(writer, binary.LittleEndian, data); err != nil {
 			return err
 		}
-		idxFd.Write(buf.Bytes())
-		v.terms.Push(restable.Term, uint64(offsetTotal))
-		offsetTotal = offsetTotal + uint64(8) + docsLen*8
+		terms.Push(restable.Term, uint64(offsetTotal))
+		offsetTotal = offsetTotal + uint64(len(data))*8
 		if closeNum == 0 {
 			break
 		}
 		maxTerm = nextMax
 		nextMax = ""
 	}
-	v.terms.Save(dicfile)
-	return v.reloadIvtFileAfterMerge(dicfile)
+	if err = writer.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write idx file in reduceRoutine")
+	}
+	dicfile := dicFile(v.filepath, v.field)
+	if err = terms.Save(dicfile + mergingSuffix); err != nil {
+		return errors.Wrap(err, "failed to save dic file in reduceRoutine")
+	}
+	if err = os.Rename(idxfile+mergingSuffix, idxfile); err != nil {
+		return errors.Wrap(err, "failed to replace idx file")
+	}
+	if err = os.Rename(dicfile+mergingSuffix, dicfile); err != nil {
+		return errors.Wrap(err, "failed to replace dic file")
+	}
+	return v.reloadIvtFileAfterMerge(terms)
 }
 
-func (v *Invert) reloadIvtFileAfterMerge(filename string) error {
-	return v.terms.Load(filename)
+// reloadIvtFileAfterMerge maps the merged idx file, the old file is unmapped while the index is locked for writing
+// by Index.SyncToDisk, so no search is reading it
+func (v *Invert) reloadIvtFileAfterMerge(terms *skeleton.TermDict) error {
+	idx, err := io.NewMmap(idxFile(v.filepath, v.field), io.ModeAppend)
+	if err != nil {
+		return errors.Wrap(err, "failed to mmap idx file")
+	}
+	old := v.idx
+	v.idx = idx
+	v.terms = terms
+	return old.Unmap()
 }
 
 func (v *Invert) searchTerm(term string) ([]Doc, bool) {
@@ -273,9 +373,320 @@ func (v *Invert) searchTerm(term string) ([]Doc, bool) {
 	return nil, false
 }
 
+// searchPostings returns the posting list of term
+func (v *Invert) searchPostings(term string) (*postingList, bool) {
+	t := strings.TrimSpace(term)
+	if len(t) == 0 {
+		return nil, false
+	}
+	offset, ok := v.terms.Get(t)
+	if !ok {
+		return nil, false
+	}
+	return v.postingsAt(offset), true
+}
+
+// postingsAt reads the posting list at offset of idx file
+func (v *Invert) postingsAt(offset uint64) *postingList {
+	docsLen := v.idx.ReadUint64(offset)
+	pl := &postingList{
+		docs:    readDocIDs(v.idx, offset+8, docsLen),
+		m:       v.idx,
+		index:   offset + 8 + docsLen*8,
+		offsets: v.offsets,
+	}
+	pl.data = pl.index + (docsLen+1)*8
+	pl.impacts = pl.data + v.idx.ReadUint64(pl.index+docsLen*8)*8
+	return pl
+}
+
+// searchPhrase returns docs containing terms at positions relative to each other
+func (v *Invert) searchPhrase(terms []string, positions []int) ([]Doc, bool) {
+	lists, candidates := v.searchCandidates(terms)
+	var docs []Doc
+	termPositions := make([][]uint64, len(terms))
+	for _, doc := range candidates {
+		for i, pl := range lists {
+			termPositions[i] = pl.positions(pl.find(doc.DocID))
+		}
+		if matchPhrase(termPositions, positions) {
+			docs = append(docs, Doc{DocID: doc.DocID, Score: 1})
+		}
+	}
+	if len(docs) == 0 {
+		return nil, false
+	}
+	return docs, true
+}
+
+// searchSloppy returns docs containing terms in any order within slop positions,
+// the closer terms are the higher the doc scores
+func (v *Invert) searchSloppy(terms []string, slop int) ([]Doc, bool) {
+	// the same term can't be matched at two places of a window
+	var unique []string
+	found := make(map[string]bool)
+	for _, term := range terms {
+		if !found[term] {
+			found[term] = true
+			unique = append(unique, term)
+		}
+	}
+	lists, candidates := v.searchCandidates(unique)
+	var docs []Doc
+	termPositions := make([][]uint64, len(unique))
+	for _, doc := range candidates {
+		for i, pl := range lists {
+			termPositions[i] = pl.positions(pl.find(doc.DocID))
+		}
+		distance := sloppyDistance(termPositions)
+		if distance >= 0 && distance <= slop {
+			docs = append(docs, Doc{DocID: doc.DocID, Score: 1 / float64(1+distance)})
+		}
+	}
+	if len(docs) == 0 {
+		return nil, false
+	}
+	return docs, true
+}
+
+// searchCandidates returns posting lists of terms and docs containing all of them
+func (v *Invert) searchCandidates(terms []string) ([]*postingList, []Doc) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	lists := make([]*postingList, len(terms))
+	var candidates []Doc
+	for i, term := range terms {
+		pl, ok := v.searchPostings(term)
+		if !ok {
+			return nil, nil
+		}
+		lists[i] = pl
+		if i == 0 {
+			candidates = pl.docs
+		} else {
+			candidates, _ = IntersectDocIDs(candidates, pl.docs)
+		}
+		if len(candidates) == 0 {
+			return nil, nil
+		}
+	}
+	return lists, candidates
+}
+
+// matchPhrase checks if there is a start that every term occurs at start plus its relative position
+func matchPhrase(termPositions [][]uint64, positions []int) bool {
+	for _, start := range termPositions[0] {
+		matched := true
+		for i := 1; i < len(termPositions); i++ {
+			want := int(start) + positions[i] - positions[0]
+			if want < 0 || !containsPosition(termPositions[i], uint64(want)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPosition(positions []uint64, pos uint64) bool {
+	i := sort.Search(len(positions), func(i int) bool { return positions[i] >= pos })
+	return i < len(positions) && positions[i] == pos
+}
+
+// sloppyDistance returns the least number of other positions in a window containing every term, or -1
+func sloppyDistance(termPositions [][]uint64) int {
+	type occurrence struct {
+		pos  uint64
+		term int
+	}
+	var occurrences []occurrence
+	for i, positions := range termPositions {
+		for _, pos := range positions {
+			occurrences = append(occurrences, occurrence{pos: pos, term: i})
+		}
+	}
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].pos < occurrences[j].pos })
+
+	// slide a window over occurrences, shrinking it whenever it covers all terms
+	counts := make([]int, len(termPositions))
+	covered, best, lo := 0, -1, 0
+	for _, o := range occurrences {
+		if counts[o.term] == 0 {
+			covered++
+		}
+		counts[o.term]++
+		for covered == len(termPositions) {
+			distance := int(o.pos-occurrences[lo].pos) - (len(termPositions) - 1)
+			if distance < 0 {
+				// words split from a longer word share its position
+				distance = 0
+			}
+			if best < 0 || distance < best {
+				best = distance
+			}
+			counts[occurrences[lo].term]--
+			if counts[occurrences[lo].term] == 0 {
+				covered--
+			}
+			lo++
+		}
+	}
+	return best
+}
+
+// encodePostings lays out postings of a term as
+// [docs length][docids...][position index of each doc, plus the end][positions and offsets of each doc]
+// [max impact of all docs][max impact of each block of PostingBlockSize docs],
+// an impact is the highest frequency and the shortest length, which bound scores of docs by any similarity
+func encodePostings(postings []posting, offsets bool) []uint64 {
+	n := len(postings)
+	data := make([]uint64, 0, 2+2*n)
+	data = append(data, uint64(n))
+	for _, p := range postings {
+		data = append(data, p.DocID)
+	}
+	var index uint64
+	for _, p := range postings {
+		data = append(data, index)
+		index += uint64(len(p.Positions))
+		if offsets {
+			index += uint64(len(p.Offsets))
+		}
+	}
+	data = append(data, index)
+	for _, p := range postings {
+		data = append(data, p.Positions...)
+		if offsets {
+			data = append(data, p.Offsets...)
+		}
+	}
+	blocks := make([]impact, 0, (n+PostingBlockSize-1)/PostingBlockSize)
+	all := newImpact()
+	for i, p := range postings {
+		if i%PostingBlockSize == 0 {
+			blocks = append(blocks, newImpact())
+		}
+		blocks[len(blocks)-1].add(uint64(len(p.Positions)), p.Length)
+		all.add(uint64(len(p.Positions)), p.Length)
+	}
+	data = append(data, all.freq, uint64(all.length))
+	for _, b := range blocks {
+		data = append(data, b.freq, uint64(b.length))
+	}
+	return data
+}
+
+// impact is the highest frequency of a term and the shortest length of fields in some docs
+type impact struct {
+	freq   uint64
+	length uint32
+}
+
+func newImpact() impact {
+	return impact{length: math.MaxUint32}
+}
+
+// add takes a doc into account, the length of docs indexed before lengths were recorded is 0
+func (m *impact) add(freq uint64, length uint32) {
+	if freq > m.freq {
+		m.freq = freq
+	}
+	if length < m.length {
+		m.length = length
+	}
+}
+
+// postingList reads postings of a term from idx file
+type postingList struct {
+	docs    []Doc
+	m       *io.Mmap
+	index   uint64
+	data    uint64
+	impacts uint64
+	offsets bool
+}
+
+// find returns index of docid in posting list, or -1
+func (p *postingList) find(docid uint64) int {
+	i := sort.Search(len(p.docs), func(i int) bool { return p.docs[i].DocID >= docid })
+	if i < len(p.docs) && p.docs[i].DocID == docid {
+		return i
+	}
+	return -1
+}
+
+// freq returns how many times the term occurs in the ith doc
+func (p *postingList) freq(i int) uint64 {
+	if i < 0 {
+		return 0
+	}
+	start := p.m.ReadUint64(p.index + uint64(i)*8)
+	end := p.m.ReadUint64(p.index + uint64(i+1)*8)
+	if p.offsets {
+		return (end - start) / 3
+	}
+	return end - start
+}
+
+// positions returns positions of the term in the ith doc
+func (p *postingList) positions(i int) []uint64 {
+	n := p.freq(i)
+	if n == 0 {
+		return nil
+	}
+	start := p.data + p.m.ReadUint64(p.index+uint64(i)*8)*8
+	positions := make([]uint64, n)
+	for j := range positions {
+		positions[j] = p.m.ReadUint64(start + uint64(j)*8)
+	}
+	return positions
+}
+
+// maxImpact returns the max impact of all docs
+func (p *postingList) maxImpact() impact {
+	return impact{freq: p.m.ReadUint64(p.impacts), length: uint32(p.m.ReadUint64(p.impacts + 8))}
+}
+
+// blockImpact returns the max impact of the block of the ith doc, and the index of the last doc in the block
+func (p *postingList) blockImpact(i int) (impact, int) {
+	block := i / PostingBlockSize
+	last := (block+1)*PostingBlockSize - 1
+	if last >= len(p.docs) {
+		last = len(p.docs) - 1
+	}
+	start := p.impacts + uint64(block+1)*16
+	return impact{freq: p.m.ReadUint64(start), length: uint32(p.m.ReadUint64(start + 8))}, last
+}
+
+// spans returns byte offsets of the term in the ith doc, if offsets are stored
+func (p *postingList) spans(i int) [][2]uint64 {
+	n := p.freq(i)
+	if n == 0 || !p.offsets {
+		return nil
+	}
+	start := p.data + (p.m.ReadUint64(p.index+uint64(i)*8)+n)*8
+	spans := make([][2]uint64, n)
+	for j := range spans {
+		spans[j][0] = p.m.ReadUint64(start + uint64(2*j)*8)
+		spans[j][1] = p.m.ReadUint64(start + uint64(2*j+1)*8)
+	}
+	return spans
+}
+
 type tmpIvt struct {
-	Term  string `json:"term"`
-	DocID uint64 `json:"docid"`
+	Term      string   `json:"term"`
+	DocID     uint64   `json:"docid"`
+	Positions []uint64 `json:"positions,omitempty"`
+	Offsets   []uint64 `json:"offsets,omitempty"`
+	Length    uint32   `json:"length,omitempty"`
+}
+
+func (t tmpIvt) posting() posting {
+	return posting{DocID: t.DocID, Positions: t.Positions, Offsets: t.Offsets, Length: t.Length}
 }
 
 // TmpIvtTermSort sorts tmpIvt array
@@ -285,11 +696,26 @@ func (t TmpIvtTermSort) Len() int           { return len(t) }
 func (t TmpIvtTermSort) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
 func (t TmpIvtTermSort) Less(i, j int) bool { return t[i].Term > t[j].Term }
 
-// Doc means docid
+// Doc means docid, score is the relevance of doc to query
 type Doc struct {
-	DocID uint64 `json:"docid`
+	DocID uint64  `json:"docid"`
+	Score float64 `json:"score"`
 }
 
+// ScoreSort sorts docs by score in descending order
+type ScoreSort []Doc
+
+func (d ScoreSort) Len() int           { return len(d) }
+func (d ScoreSort) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d ScoreSort) Less(i, j int) bool { return d[i].Score > d[j].Score }
+
+// PostingSort sorts postings by docid
+type PostingSort []posting
+
+func (p PostingSort) Len() int           { return len(p) }
+func (p PostingSort) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p PostingSort) Less(i, j int) bool { return p[i].DocID < p[j].DocID }
+
 // DocSort sorts doc array
 type DocSort []Doc
 
@@ -310,11 +736,16 @@ func ivtFile(filepath string, field string, num uint64) string {
 }
 
 func readDocIDs(m *io.Mmap, start uint64, idsLen uint64) []Doc {
-	return *(*[]Doc)(unsafe.Pointer(&reflect.SliceHeader{
+	ids := *(*[]uint64)(unsafe.Pointer(&reflect.SliceHeader{
 		Data: uintptr(unsafe.Pointer(&m.MmapBytes[start])),
 		Len:  int(idsLen),
 		Cap:  int(idsLen),
 	}))
+	docs := make([]Doc, idsLen)
+	for i, id := range ids {
+		docs[i].DocID = id
+	}
+	return docs
 }
 
 func (v *Invert) string() string {
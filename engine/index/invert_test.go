@@ -3,6 +3,7 @@ package index
 import (
 	"testing"
 
+	"github.com/cosmtrek/violet/pkg/skeleton"
 	"github.com/cosmtrek/violet/pkg/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -77,3 +78,117 @@ func TestInvert_addDocument_saveTmpInvert_mergeTmpInvert_searchTerm(t *testing.T
 	expected2 := []Doc{{DocID: 15}, {DocID: 32}}
 	assert.EqualValues(t, expected2, docs2)
 }
+
+func TestInvert_searchPhrase(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	invert, err := NewInvert(path, "field2", TString, segmenter())
+	assert.Nil(t, err)
+	invert.offsets = true
+	invert.addDocument(uint64(0), "tom brady super bowl")
+	invert.addDocument(uint64(1), "brady tom, super bowl")
+	invert.addDocument(uint64(2), "就老去吧 孤独别醒来")
+	assert.Nil(t, invert.saveTmpInvert())
+	assert.Nil(t, invert.mergeTmpInvert())
+
+	docs, found := invert.searchPhrase([]string{"tom", "brady"}, []int{0, 1})
+	assert.True(t, found)
+	assert.EqualValues(t, []Doc{{DocID: 0, Score: 1}}, docs)
+	docs, found = invert.searchPhrase([]string{"tom", "super"}, []int{0, 1})
+	assert.True(t, found)
+	assert.EqualValues(t, []Doc{{DocID: 1, Score: 1}}, docs)
+	_, found = invert.searchPhrase([]string{"super", "tom"}, []int{0, 1})
+	assert.False(t, found)
+	var terms []string
+	var positions []int
+	for _, token := range segmenter().Tokenize("孤独别醒来", false) {
+		terms = append(terms, token.Text)
+		positions = append(positions, token.Position)
+	}
+	docs, found = invert.searchPhrase(terms, positions)
+	assert.True(t, found)
+	assert.EqualValues(t, []Doc{{DocID: 2, Score: 1}}, docs)
+
+	pl, ok := invert.searchPostings("brady")
+	assert.True(t, ok)
+	assert.Equal(t, []uint64{1}, pl.positions(pl.find(0)))
+	assert.Equal(t, [][2]uint64{{4, 9}}, pl.spans(pl.find(0)))
+	assert.Equal(t, []uint64{0}, pl.positions(pl.find(1)))
+	assert.Equal(t, -1, pl.find(2))
+}
+
+func TestInvert_searchSloppy(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	invert, err := NewInvert(path, "field3", TString, segmenter())
+	assert.Nil(t, err)
+	invert.addDocument(uint64(0), "tom brady super bowl")
+	invert.addDocument(uint64(1), "brady tom")
+	invert.addDocument(uint64(2), "tom threw to brady")
+	invert.addDocument(uint64(3), "tom hanks")
+	assert.Nil(t, invert.saveTmpInvert())
+	assert.Nil(t, invert.mergeTmpInvert())
+
+	docs, found := invert.searchSloppy([]string{"tom", "brady"}, 0)
+	assert.True(t, found)
+	assert.EqualValues(t, []Doc{{DocID: 0, Score: 1}, {DocID: 1, Score: 1}}, docs)
+	docs, found = invert.searchSloppy([]string{"brady", "tom"}, 2)
+	assert.True(t, found)
+	assert.EqualValues(t, []Doc{{DocID: 0, Score: 1}, {DocID: 1, Score: 1}, {DocID: 2, Score: 1.0 / 3}}, docs)
+	_, found = invert.searchSloppy([]string{"tom", "bowl"}, 1)
+	assert.False(t, found)
+}
+
+func TestSloppyDistance(t *testing.T) {
+	assert.Equal(t, 0, sloppyDistance([][]uint64{{0}, {1}}))
+	assert.Equal(t, 0, sloppyDistance([][]uint64{{1}, {0}}))
+	assert.Equal(t, 1, sloppyDistance([][]uint64{{0, 9}, {2}, {3}}))
+	assert.Equal(t, 0, sloppyDistance([][]uint64{{3}, {3}}))
+	assert.Equal(t, -1, sloppyDistance([][]uint64{{3}, {}}))
+}
+
+func TestInvert_mergeTmpInvert_Incremental(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	invert, err := NewInvert(path, "field4", TString, segmenter())
+	assert.Nil(t, err)
+	invert.offsets = true
+	invert.norms = skeleton.NewNorms()
+	invert.norms.Set(0, 4)
+	invert.norms.Set(1, 2)
+	invert.addDocument(uint64(0), "tom brady super bowl")
+	invert.addDocument(uint64(1), "tom hanks")
+	assert.Nil(t, invert.saveTmpInvert())
+	assert.Nil(t, invert.mergeTmpInvert())
+	// merged segments are removed, the idx file is merged with new segments only
+	assert.False(t, utils.FileExists(ivtFile(path, "field4", 0)))
+	invert.addDocument(uint64(2), "brady tom")
+	assert.Nil(t, invert.saveTmpInvert())
+	invert.addDocument(uint64(3), "matt ryan")
+	assert.Nil(t, invert.saveTmpInvert())
+	assert.Nil(t, invert.mergeTmpInvert())
+	assert.False(t, utils.FileExists(ivtFile(path, "field4", 1)))
+	assert.Nil(t, invert.mergeTmpInvert())
+
+	docs, found := invert.searchTerm("tom")
+	assert.True(t, found)
+	assert.EqualValues(t, []Doc{{DocID: 0}, {DocID: 1}, {DocID: 2}}, docs)
+	docs, found = invert.searchTerm("ryan")
+	assert.True(t, found)
+	assert.EqualValues(t, []Doc{{DocID: 3}}, docs)
+	pl, ok := invert.searchPostings("brady")
+	assert.True(t, ok)
+	assert.Equal(t, [][2]uint64{{4, 9}}, pl.spans(pl.find(0)))
+	assert.Equal(t, []uint64{0}, pl.positions(pl.find(2)))
+	// lengths of docs merged before are read from norms
+	pl, ok = invert.searchPostings("hanks")
+	assert.True(t, ok)
+	assert.Equal(t, impact{freq: 1, length: 2}, pl.maxImpact())
+
+	// merged files are loaded when reopened
+	invert, err = NewInvert(path, "field4", TString, segmenter())
+	assert.Nil(t, err)
+	docs, found = invert.searchTerm("tom")
+	assert.True(t, found)
+	assert.Equal(t, 3, len(docs))
+}
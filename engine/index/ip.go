@@ -0,0 +1,183 @@
+package index
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ipBlock is a CIDR block of 16 bytes address, IPv4 is mapped into IPv6
+type ipBlock struct {
+	IP     [16]byte
+	Prefix int
+}
+
+func (b ipBlock) String() string {
+	return fmt.Sprintf("%s/%d", net.IP(b.IP[:]).String(), b.Prefix)
+}
+
+// parseIP parses IPv4 or IPv6 address into 16 bytes
+func parseIP(text string) ([16]byte, error) {
+	var ip [16]byte
+	parsed := net.ParseIP(strings.TrimSpace(text))
+	if parsed == nil {
+		return ip, errors.Errorf("invalid ip %s", text)
+	}
+	copy(ip[:], parsed.To16())
+	return ip, nil
+}
+
+// ParseIPQuery parses "ip", "ip/prefix" or "ip1-ip2" into CIDR blocks
+func ParseIPQuery(text string) ([]ipBlock, error) {
+	if strings.Contains(text, "/") {
+		_, network, err := net.ParseCIDR(text)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid cidr")
+		}
+		ones, bits := network.Mask.Size()
+		var block ipBlock
+		copy(block.IP[:], network.IP.To16())
+		block.Prefix = ones + 128 - bits
+		return []ipBlock{block}, nil
+	}
+	if strings.Contains(text, "-") {
+		parts := strings.SplitN(text, "-", 2)
+		start, err := parseIP(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseIP(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Compare(start[:], end[:]) > 0 {
+			return nil, errors.Errorf("invalid ip range %s", text)
+		}
+		return rangeToBlocks(start, end), nil
+	}
+	ip, err := parseIP(text)
+	if err != nil {
+		return nil, err
+	}
+	return []ipBlock{{IP: ip, Prefix: 128}}, nil
+}
+
+// rangeToBlocks splits range of addresses into the fewest CIDR blocks
+func rangeToBlocks(start, end [16]byte) []ipBlock {
+	var blocks []ipBlock
+	for {
+		prefix := 128
+		for p := 0; p <= 128; p++ {
+			last := lastIP(start, p)
+			if maskIP(start, p) == start && bytes.Compare(last[:], end[:]) <= 0 {
+				prefix = p
+				break
+			}
+		}
+		blocks = append(blocks, ipBlock{IP: start, Prefix: prefix})
+		last := lastIP(start, prefix)
+		if last == end {
+			return blocks
+		}
+		start = nextIP(last)
+	}
+}
+
+// maskIP clears bits after prefix
+func maskIP(ip [16]byte, prefix int) [16]byte {
+	for i := range ip {
+		bits := prefix - i*8
+		switch {
+		case bits <= 0:
+			ip[i] = 0
+		case bits < 8:
+			ip[i] &= byte(0xff << uint(8-bits))
+		}
+	}
+	return ip
+}
+
+// lastIP sets bits after prefix
+func lastIP(ip [16]byte, prefix int) [16]byte {
+	for i := range ip {
+		bits := prefix - i*8
+		switch {
+		case bits <= 0:
+			ip[i] = 0xff
+		case bits < 8:
+			ip[i] |= byte(0xff >> uint(bits))
+		}
+	}
+	return ip
+}
+
+func nextIP(ip [16]byte) [16]byte {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+		if ip[i] != 0 {
+			break
+		}
+	}
+	return ip
+}
+
+// ipTerm is the term of the first prefix bits of ip, prefix is multiple of 8
+func ipTerm(ip [16]byte, prefix int) string {
+	return fmt.Sprintf("%d/%s", prefix, hex.EncodeToString(ip[:prefix/8]))
+}
+
+// ipTerms returns terms of every byte boundary prefix, so CIDR blocks are looked up without scanning
+func ipTerms(doc string) []string {
+	ip, err := parseIP(doc)
+	if err != nil {
+		return nil
+	}
+	terms := make([]string, 0, 16)
+	for prefix := 8; prefix <= 128; prefix += 8 {
+		terms = append(terms, ipTerm(ip, prefix))
+	}
+	return terms
+}
+
+// blockTerms returns terms that cover the block exactly, blocks not aligned to byte are split into smaller blocks
+func blockTerms(block ipBlock) []string {
+	aligned := (block.Prefix + 7) / 8 * 8
+	count := 1 << uint(aligned-block.Prefix)
+	terms := make([]string, 0, count)
+	ip := maskIP(block.IP, block.Prefix)
+	for i := 0; i < count; i++ {
+		terms = append(terms, ipTerm(ip, aligned))
+		if i < count-1 {
+			ip = nextIP(lastIP(ip, aligned))
+		}
+	}
+	return terms
+}
+
+// searchIP searches docs whose ip is in any of blocks
+func (f *Field) searchIP(blocks []ipBlock) ([]Doc, bool) {
+	if f.invert == nil || f.Type != TIP {
+		return nil, false
+	}
+	var docs []Doc
+	for _, block := range blocks {
+		if block.Prefix == 0 {
+			docs, _ = MergeDocIDs(docs, f.existDocs())
+			continue
+		}
+		for _, term := range blockTerms(block) {
+			termDocs, ok := f.invert.searchTerm(term)
+			if ok {
+				docs, _ = MergeDocIDs(docs, termDocs)
+			}
+		}
+	}
+	if len(docs) == 0 {
+		return nil, false
+	}
+	return docs, true
+}
@@ -0,0 +1,88 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPQuery(t *testing.T) {
+	blocks, err := ParseIPQuery("10.0.0.0/8")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(blocks))
+	assert.Equal(t, "10.0.0.0/104", blocks[0].String())
+
+	blocks, err = ParseIPQuery("2001:db8::1")
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8::1/128", blocks[0].String())
+
+	blocks, err = ParseIPQuery("10.0.0.1-10.0.0.8")
+	assert.Nil(t, err)
+	var actual []string
+	for _, b := range blocks {
+		actual = append(actual, b.String())
+	}
+	assert.Equal(t, []string{"10.0.0.1/128", "10.0.0.2/127", "10.0.0.4/126", "10.0.0.8/128"}, actual)
+
+	_, err = ParseIPQuery("10.0.0.8-10.0.0.1")
+	assert.NotNil(t, err)
+	_, err = ParseIPQuery("10.0.0/8")
+	assert.NotNil(t, err)
+	_, err = ParseIPQuery("localhost")
+	assert.NotNil(t, err)
+}
+
+func TestBlockTerms(t *testing.T) {
+	blocks, _ := ParseIPQuery("10.0.0.0/16")
+	assert.Equal(t, []string{"112/00000000000000000000ffff0a00"}, blockTerms(blocks[0]))
+	blocks, _ = ParseIPQuery("172.16.0.0/12")
+	terms := blockTerms(blocks[0])
+	assert.Equal(t, 16, len(terms))
+	assert.Equal(t, "112/00000000000000000000ffffac10", terms[0])
+	assert.Equal(t, "112/00000000000000000000ffffac1f", terms[15])
+}
+
+func TestIndex_SearchIP(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	err = index.IndexFields(map[string]uint64{"a": TString, "client": TIP})
+	assert.Nil(t, err)
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "get index", "client": "10.0.0.1"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "get index", "client": "10.1.2.3"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "post index", "client": "172.20.0.9"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "get index", "client": "2001:db8::1"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"a": "get index", "client": "unknown"}))
+	assert.Nil(t, index.SyncToDisk())
+
+	doc3, ok := index.GetDocument(3)
+	assert.True(t, ok)
+	assert.Equal(t, "2001:db8::1", doc3["client"])
+	doc4, ok := index.GetDocument(4)
+	assert.True(t, ok)
+	_, ok = doc4["client"]
+	assert.False(t, ok)
+
+	docs1, found1 := index.Search("client:10.0.0.0/8")
+	assert.True(t, found1)
+	assert.EqualValues(t, []Doc{{DocID: 0}, {DocID: 1}}, docs1)
+	docs2, found2 := index.Search("client:172.16.0.0/12")
+	assert.True(t, found2)
+	assert.EqualValues(t, []Doc{{DocID: 2}}, docs2)
+	docs3, found3 := index.Search("client:2001:db8::/32")
+	assert.True(t, found3)
+	assert.EqualValues(t, []Doc{{DocID: 3}}, docs3)
+	docs4, found4 := index.Search("client:10.0.0.1")
+	assert.True(t, found4)
+	assert.EqualValues(t, []Doc{{DocID: 0}}, docs4)
+	docs5, found5 := index.Search("client:10.0.0.0-10.1.255.255")
+	assert.True(t, found5)
+	assert.EqualValues(t, []Doc{{DocID: 0}, {DocID: 1}}, docs5)
+	_, found6 := index.Search("client:192.168.0.0/16")
+	assert.False(t, found6)
+	docs7, found7 := index.Search("get -client:10.0.0.0/8")
+	assert.True(t, found7)
+	assert.Equal(t, []uint64{3, 4}, docIDs(docs7))
+}
@@ -0,0 +1,144 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenWord
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+// token is the smallest unit of query string, pos is the byte offset in query string
+type token struct {
+	typ  tokenType
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of query"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// lex splits query string into tokens
+func lex(input string) []token {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		r, w := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += w
+		case r == '(':
+			tokens = append(tokens, token{typ: tokenLParen, text: "(", pos: i})
+			i += w
+		case r == ')':
+			tokens = append(tokens, token{typ: tokenRParen, text: ")", pos: i})
+			i += w
+		case r == '-' && i+1 < len(input) && !isWordEnd(input[i+1:]):
+			// "-word" excludes word
+			tokens = append(tokens, token{typ: tokenNot, text: "-", pos: i})
+			i += w
+		default:
+			start := i
+			i = scanWord(input, i)
+			text := input[start:i]
+			tok := token{typ: tokenWord, text: text, pos: start}
+			switch text {
+			case "AND", "&&":
+				tok.typ = tokenAnd
+			case "OR", "||":
+				tok.typ = tokenOr
+			case "NOT", "!":
+				tok.typ = tokenNot
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+	return append(tokens, token{typ: tokenEOF, pos: len(input)})
+}
+
+// scanWord returns the end of word starting at i, a function like "loc:within(39.9,116.4,10km)",
+// a phrase like title:"tom brady", a range like "len:[1 TO 5}" or a regexp like "name:/br[ae]dy/" is a single word
+func scanWord(input string, i int) int {
+	start := i
+	for i < len(input) {
+		r, w := utf8.DecodeRuneInString(input[i:])
+		if r == '"' {
+			end := strings.Index(input[i+1:], `"`)
+			if end < 0 {
+				return len(input)
+			}
+			i += end + 2
+			continue
+		}
+		if (r == '[' || r == '{') && (i == start || strings.HasSuffix(input[start:i], ":")) {
+			end := strings.IndexAny(input[i:], "]}")
+			if end < 0 {
+				return len(input)
+			}
+			i += end + 1
+			continue
+		}
+		if r == '/' && (i == start || strings.HasSuffix(input[start:i], ":")) {
+			if end := regexpEnd(input[i+1:]); end >= 0 {
+				i += end + 2
+				continue
+			}
+		}
+		if unicode.IsSpace(r) || r == ')' {
+			return i
+		}
+		if r == '(' {
+			word := input[start:i]
+			if !strings.Contains(word, ":") || strings.HasSuffix(word, ":") {
+				return i
+			}
+			end := strings.Index(input[i:], ")")
+			if end < 0 {
+				return len(input)
+			}
+			i += end + 1
+			continue
+		}
+		i += w
+	}
+	return i
+}
+
+// regexpEnd returns index of the first '/' not escaped by backslash, or -1
+func regexpEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '/':
+			return i
+		}
+	}
+	return -1
+}
+
+func isWordEnd(rest string) bool {
+	r, _ := utf8.DecodeRuneInString(rest)
+	return unicode.IsSpace(r) || r == ')'
+}
@@ -0,0 +1,45 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLex(t *testing.T) {
+	tokens := lex(`(tom OR brady) AND -movie loc:within(39.9,116.4,10km) a:(x y)`)
+	var types []tokenType
+	var texts []string
+	for _, tok := range tokens {
+		types = append(types, tok.typ)
+		texts = append(texts, tok.text)
+	}
+	assert.Equal(t, []tokenType{tokenLParen, tokenWord, tokenOr, tokenWord, tokenRParen, tokenAnd, tokenNot, tokenWord,
+		tokenWord, tokenWord, tokenLParen, tokenWord, tokenWord, tokenRParen, tokenEOF}, types)
+	assert.Equal(t, []string{"(", "tom", "OR", "brady", ")", "AND", "-", "movie",
+		"loc:within(39.9,116.4,10km)", "a:", "(", "x", "y", ")", ""}, texts)
+	assert.Equal(t, 8, tokens[3].pos)
+
+	tokens = lex("co-op - 10")
+	assert.Equal(t, "co-op", tokens[0].text)
+	assert.Equal(t, tokenWord, tokens[1].typ)
+	assert.Equal(t, "-", tokens[1].text)
+}
+
+func TestLex_Range(t *testing.T) {
+	tokens := lex(`len:[1 TO 5} -created:{* TO "2020-01-01 10:00:00"] [a b]`)
+	var texts []string
+	for _, tok := range tokens {
+		texts = append(texts, tok.text)
+	}
+	assert.Equal(t, []string{"len:[1 TO 5}", "-", `created:{* TO "2020-01-01 10:00:00"]`, "[a b]", ""}, texts)
+}
+
+func TestLex_Regexp(t *testing.T) {
+	tokens := lex(`a:/br(a|e) dy/ /t\/m/ http://t.co/abc /tmp x`)
+	var texts []string
+	for _, tok := range tokens {
+		texts = append(texts, tok.text)
+	}
+	assert.Equal(t, []string{"a:/br(a|e) dy/", `/t\/m/`, "http://t.co/abc", "/tmp", "x", ""}, texts)
+}
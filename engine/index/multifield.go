@@ -0,0 +1,100 @@
+package index
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ModeCrossFields matches words of a query in any of fields as if they were one field
+	ModeCrossFields = "cross_fields"
+	// ModeBestFields matches all words of a query in the same field, docs score by the best field
+	ModeBestFields = "best_fields"
+)
+
+var reBoost = regexp.MustCompile(`\^([0-9]*\.?[0-9]+)$`)
+
+// searchField is a string field to search with the boost of its scores
+type searchField struct {
+	name  string
+	boost float64
+}
+
+// SetDefaultFields sets string fields that words without field are searched in, a field can be boosted like "title^3"
+func (x *Index) SetDefaultFields(fields []string) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	for _, f := range fields {
+		name, boost, ok := splitBoost(f)
+		if !ok && strings.Contains(f, "^") {
+			return errors.Errorf("invalid boost of field %s", f)
+		}
+		if boost < 0 {
+			return errors.Errorf("boost of field %s must not be negative", f)
+		}
+		if ftype, ok := x.FieldMeta[name]; !ok || ftype != TString {
+			return errors.Errorf("field %s is not a string field", name)
+		}
+	}
+	x.DefaultFields = fields
+	return nil
+}
+
+// SetMultiFieldMode sets how words of a query match across default fields, "cross_fields" or "best_fields"
+func (x *Index) SetMultiFieldMode(mode string) error {
+	if mode != ModeCrossFields && mode != ModeBestFields {
+		return errors.Errorf("invalid multi field mode %s", mode)
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.MultiFieldMode = mode
+	return nil
+}
+
+// searchFields returns the string field, or fields given like "title^3", or default fields of index,
+// or all string fields in order of name
+func (x *Index) searchFields(field string, fields []string) []searchField {
+	if field != "" {
+		if x.FieldMeta[field] == TString {
+			return []searchField{{name: field, boost: 1}}
+		}
+		return nil
+	}
+	if len(fields) == 0 {
+		fields = x.DefaultFields
+	}
+	var result []searchField
+	if len(fields) == 0 {
+		for name, ftype := range x.FieldMeta {
+			if ftype == TString {
+				result = append(result, searchField{name: name, boost: 1})
+			}
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+		return result
+	}
+	for _, f := range fields {
+		name, boost, _ := splitBoost(f)
+		if x.FieldMeta[name] == TString {
+			result = append(result, searchField{name: name, boost: boost})
+		}
+	}
+	return result
+}
+
+// splitBoost splits "text^2" into text and boost, boost is 1 if there is none
+func splitBoost(text string) (string, float64, bool) {
+	match := reBoost.FindStringSubmatchIndex(text)
+	if match == nil || match[0] == 0 {
+		return text, 1, false
+	}
+	boost, err := strconv.ParseFloat(text[match[2]:match[3]], 64)
+	if err != nil {
+		return text, 1, false
+	}
+	return text[:match[0]], boost, true
+}
@@ -0,0 +1,74 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBoost(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected string
+		boost    float64
+		ok       bool
+	}{
+		{"title^3", "title", 3, true},
+		{"tom^0.5", "tom", 0.5, true},
+		{`"tom brady"^2`, `"tom brady"`, 2, true},
+		{"tom", "tom", 1, false},
+		{"^2", "^2", 1, false},
+		{"tom^x", "tom^x", 1, false},
+	}
+	for _, c := range cases {
+		text, boost, ok := splitBoost(c.text)
+		assert.Equal(t, c.expected, text, c.text)
+		assert.Equal(t, c.boost, boost, c.text)
+		assert.Equal(t, c.ok, ok, c.text)
+	}
+}
+
+func TestIndex_SetDefaultFields_MultiFieldMode(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(map[string]uint64{"title": TString, "text": TString, "likes": TNumber}))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "tom brady", "text": "super bowl"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "super bowl", "text": "tom brady movie"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "tom hanks", "text": "brady bunch"}))
+	assert.Nil(t, index.SyncToDisk())
+
+	assert.Equal(t, []searchField{{"text", 1}, {"title", 1}}, index.searchFields("", nil))
+	assert.Equal(t, []searchField{{"title", 1}}, index.searchFields("title", []string{"text"}))
+	assert.Nil(t, index.searchFields("likes", nil))
+
+	assert.NotNil(t, index.SetDefaultFields([]string{"likes"}))
+	assert.NotNil(t, index.SetDefaultFields([]string{"none"}))
+	assert.NotNil(t, index.SetDefaultFields([]string{"title^x"}))
+	assert.NotNil(t, index.SetMultiFieldMode("most_fields"))
+	assert.Nil(t, index.SetDefaultFields([]string{"title^3", "text"}))
+	assert.Equal(t, []searchField{{"title", 3}, {"text", 1}}, index.searchFields("", nil))
+
+	docs, found := index.Search("tom brady")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{0, 2, 1}, docIDs(docs))
+	docs, found = index.Search("text:tom^2 OR hanks")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{2, 1}, docIDs(docs))
+
+	req := &SearchRequest{Query: []byte(`{"multi_match": {"query": "tom brady"}}`)}
+	result, err := index.SearchDSL(req)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0, 2, 1}, docIDs(result.Docs))
+
+	// all words of text must match in the same field
+	assert.Nil(t, index.SetMultiFieldMode(ModeBestFields))
+	result, err = index.SearchDSL(req)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0, 1}, docIDs(result.Docs))
+	docs, found = index.Search("bunch")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{2}, docIDs(docs))
+}
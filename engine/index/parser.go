@@ -0,0 +1,496 @@
+package index
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// OperatorAnd requires all clauses to match
+	OperatorAnd = "AND"
+	// OperatorOr requires any clause to match
+	OperatorOr = "OR"
+)
+
+// ParseError is a syntax error of query at a byte offset of it
+type ParseError struct {
+	Pos    int    `json:"pos"`
+	Reason string `json:"reason"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at %d", e.Reason, e.Pos)
+}
+
+func parseErrorf(pos int, format string, args ...interface{}) error {
+	return &ParseError{Pos: pos, Reason: fmt.Sprintf(format, args...)}
+}
+
+// parser builds query syntax tree from tokens:
+//
+//	query   = or
+//	or      = and { "OR" and }
+//	and     = unary { ["AND"] unary }
+//	unary   = { "NOT" | "-" } primary
+//	primary = "(" or ")" [ "^" boost ] | field ":(" or ")" [ "^" boost ] | clause [ "^" boost ]
+//
+// clauses next to each other without operator are combined by the default operator
+type parser struct {
+	index     *Index
+	tokens    []token
+	pos       int
+	defaultOp string
+	// field is set inside "field:( ... )"
+	field string
+}
+
+// parseQuery parses query string into syntax tree, a nil node matches nothing
+func parseQuery(index *Index, input string, defaultOp string) (Node, error) {
+	if defaultOp != OperatorOr {
+		defaultOp = OperatorAnd
+	}
+	p := &parser{
+		index:     index,
+		tokens:    lex(input),
+		defaultOp: defaultOp,
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.typ != tokenEOF {
+		return nil, parseErrorf(tok.pos, "unexpected %s", tok)
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.typ != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// startsClause checks if token can begin a clause, so two clauses are next to each other
+func startsClause(tok token) bool {
+	return tok.typ == tokenWord || tok.typ == tokenLParen || tok.typ == tokenNot
+}
+
+func (p *parser) parseOr() (Node, error) {
+	var nodes []Node
+	// explicit[i] is true if nodes[i] and nodes[i+1] are joined by "OR"
+	var explicit []bool
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		tok := p.peek()
+		if tok.typ == tokenOr {
+			p.next()
+			explicit = append(explicit, true)
+			continue
+		}
+		if startsClause(tok) && p.defaultOp == OperatorOr {
+			explicit = append(explicit, false)
+			continue
+		}
+		break
+	}
+	var children, excluded []Node
+	for i, node := range nodes {
+		// "word1 -word2" excludes word2 rather than adding docs without word2
+		_, isNot := node.(*notQuery)
+		if isNot && (i == 0 || !explicit[i-1]) && (i == len(explicit) || !explicit[i]) {
+			excluded = append(excluded, node)
+			continue
+		}
+		children = appendNode(children, node)
+	}
+	node := newBoolQuery(OperatorOr, children)
+	if len(excluded) == 0 {
+		return node, nil
+	}
+	return newBoolQuery(OperatorAnd, append(appendNode(nil, node), excluded...)), nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var children []Node
+	for {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = appendNode(children, node)
+		tok := p.peek()
+		if tok.typ == tokenAnd {
+			p.next()
+			continue
+		}
+		if startsClause(tok) && p.defaultOp == OperatorAnd {
+			continue
+		}
+		break
+	}
+	return newBoolQuery(OperatorAnd, children), nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.peek()
+	if tok.typ == tokenNot {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, nil
+		}
+		if not, ok := node.(*notQuery); ok {
+			return not.child, nil
+		}
+		return &notQuery{child: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.next()
+	switch tok.typ {
+	case tokenLParen:
+		return p.parseGroup(tok)
+	case tokenWord:
+		// search "field:(word1 OR word2)"
+		if strings.HasSuffix(tok.text, ":") && p.peek().typ == tokenLParen && p.field == "" {
+			name := strings.TrimSuffix(tok.text, ":")
+			if _, ok := p.index.FieldMeta[name]; !ok {
+				return nil, parseErrorf(tok.pos, "unknown field %s", name)
+			}
+			p.field = name
+			node, err := p.parseGroup(p.next())
+			p.field = ""
+			return node, err
+		}
+		return p.parseClause(tok)
+	case tokenEOF:
+		return nil, parseErrorf(tok.pos, "unexpected end of query")
+	default:
+		return nil, parseErrorf(tok.pos, "unexpected %s", tok)
+	}
+}
+
+func (p *parser) parseGroup(lparen token) (Node, error) {
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	rparen := p.next()
+	if rparen.typ != tokenRParen {
+		return nil, parseErrorf(lparen.pos, "missing ')' for '('")
+	}
+	// search "(word1 word2)^2"
+	if tok := p.peek(); tok.typ == tokenWord && tok.pos == rparen.pos+1 && strings.HasPrefix(tok.text, "^") {
+		p.next()
+		rest, boost, ok := splitBoost(")" + tok.text)
+		if !ok || rest != ")" {
+			return nil, parseErrorf(tok.pos, "invalid boost %s", tok.text)
+		}
+		return newBoostQuery(node, boost), nil
+	}
+	return node, nil
+}
+
+// parseClause parses a single word like "word", "field:word", "field>10" or "_exists_:field",
+// which can be boosted like "word^2"
+func (p *parser) parseClause(tok token) (Node, error) {
+	text, boost, ok := splitBoost(tok.text)
+	if !ok || isRegexp(tok.text) {
+		return p.clause(tok)
+	}
+	tok.text = text
+	node, err := p.clause(tok)
+	if err != nil {
+		return nil, err
+	}
+	return newBoostQuery(node, boost), nil
+}
+
+func (p *parser) clause(tok token) (Node, error) {
+	text := tok.text
+	if p.field != "" {
+		return p.fieldClause(p.field, text, tok)
+	}
+	// search "\"tom brady\""
+	if strings.HasPrefix(text, `"`) {
+		return p.phraseClause("", text, tok)
+	}
+	if isRegexp(text) {
+		return p.regexpClause("", text, tok)
+	}
+	// search "len>5", "len>=5" or "len!=5"
+	if operator, isCompare := HasCompare(text); isCompare {
+		segkv := strings.SplitN(text, operator, 2)
+		if ftype, ok := p.index.FieldMeta[segkv[0]]; ok && isNumeric(ftype) {
+			return p.compareClause(segkv[0], operator, segkv[1], tok)
+		}
+	}
+	if i := strings.Index(text, ":"); i > 0 {
+		name, value := text[:i], text[i+1:]
+		if name == ExistsField {
+			return &existsQuery{field: value}, nil
+		}
+		// words like "http://t.co" are not fields
+		if _, ok := p.index.FieldMeta[name]; ok {
+			node, err := p.fieldClause(name, value, tok)
+			// words like "time:http://t.co" are not fields either if value is invalid for the field
+			if err != nil && strings.Contains(value, ":") {
+				return p.termClause("", text), nil
+			}
+			return node, err
+		}
+	}
+	if isWildcard(text) {
+		return p.wildcardClause("", text, tok)
+	}
+	if word, distance, ok := parseFuzzy(text); ok {
+		return p.fuzzyClause("", word, distance, tok)
+	}
+	return p.termClause("", text), nil
+}
+
+// fieldClause parses value of a field by its type
+func (p *parser) fieldClause(field, value string, tok token) (Node, error) {
+	if value == "" {
+		return nil, parseErrorf(tok.pos, "missing value of field %s", field)
+	}
+	switch p.index.FieldMeta[field] {
+	case TNumber, TDate:
+		// search "field:[a TO b]", "field:{a TO b}" or "field:value", a day of date field matches the whole day
+		if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") {
+			return p.rangeClause(field, value, tok)
+		}
+		if start, end, ok := parseDay(value); ok && p.index.FieldMeta[field] == TDate {
+			return newBoolQuery(OperatorAnd, []Node{
+				&compareQuery{field: field, op: GREATEREQUAL, value: start},
+				&compareQuery{field: field, op: LESSEQUAL, value: end},
+			}), nil
+		}
+		return p.compareClause(field, "=", value, tok)
+	case TGeo:
+		// search "field:within(lat,lon,distance)" or "field:box(top,left,bottom,right)"
+		shape, err := ParseGeoShape(value)
+		if err != nil {
+			return nil, parseErrorf(tok.pos, "invalid geo shape: %v", err)
+		}
+		return &geoQuery{field: field, shape: shape}, nil
+	case TIP:
+		// search "field:ip", "field:ip/prefix" or "field:ip1-ip2"
+		blocks, err := ParseIPQuery(value)
+		if err != nil {
+			return nil, parseErrorf(tok.pos, "invalid ip query: %v", err)
+		}
+		return &ipQuery{field: field, blocks: blocks}, nil
+	case TKeyword:
+		// search "field:value" or "field:\"value with spaces\"" exactly
+		if len(value) > 1 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = value[1 : len(value)-1]
+		}
+		return &keywordQuery{field: field, value: value}, nil
+	default:
+		if strings.HasPrefix(value, `"`) {
+			return p.phraseClause(field, value, tok)
+		}
+		if isRegexp(value) {
+			return p.regexpClause(field, value, tok)
+		}
+		if isWildcard(value) {
+			return p.wildcardClause(field, value, tok)
+		}
+		if word, distance, ok := parseFuzzy(value); ok {
+			return p.fuzzyClause(field, word, distance, tok)
+		}
+		return p.termClause(field, value), nil
+	}
+}
+
+// wildcardClause expands pattern to terms in dictionary
+func (p *parser) wildcardClause(field, pattern string, tok token) (Node, error) {
+	pattern = strings.ToLower(pattern)
+	expansions, err := p.index.expandFields(field, wildcardPrefix(pattern), func(term string) bool {
+		return matchWildcard(pattern, term)
+	})
+	if err != nil {
+		return nil, parseErrorf(tok.pos, "too many terms for %s: %v", pattern, err)
+	}
+	return &multiTermQuery{field: field, text: pattern, expansions: expansions, match: func(term string) bool {
+		return matchWildcard(pattern, term)
+	}}, nil
+}
+
+// regexpClause expands "/pattern/" to terms in dictionary fully matching the pattern
+func (p *parser) regexpClause(field, value string, tok token) (Node, error) {
+	pattern := value[1 : len(value)-1]
+	re, prefix, err := compileTermRegexp(pattern)
+	if err != nil {
+		return nil, parseErrorf(tok.pos, "invalid regexp: %v", err)
+	}
+	if prefix == "" && !p.index.AllowRegexpScan {
+		return nil, parseErrorf(tok.pos, "regexp %s without literal prefix requires a full scan", value)
+	}
+	expansions, err := p.index.expandFields(field, prefix, re.MatchString)
+	if err != nil {
+		return nil, parseErrorf(tok.pos, "too many terms for %s: %v", value, err)
+	}
+	return &multiTermQuery{field: field, text: value, expansions: expansions, match: re.MatchString}, nil
+}
+
+// fuzzyClause expands word to terms in dictionary within edit distance
+func (p *parser) fuzzyClause(field, word, distance string, tok token) (Node, error) {
+	d, err := fuzzyDistance(distance)
+	if err != nil {
+		return nil, parseErrorf(tok.pos, "%v", err)
+	}
+	word = strings.ToLower(word)
+	expansions, boosts, err := p.index.fuzzyFields(field, word, d)
+	if err != nil {
+		return nil, parseErrorf(tok.pos, "too many terms for %s~%d: %v", word, d, err)
+	}
+	automaton := newLevenshteinAutomaton(word, d)
+	return &multiTermQuery{field: field, text: fmt.Sprintf("%s~%d", word, d), expansions: expansions, boosts: boosts,
+		match: func(term string) bool {
+			_, ok := automaton.match(term)
+			return ok
+		}}, nil
+}
+
+// phraseClause parses quoted text into terms with their positions
+func (p *parser) phraseClause(field, value string, tok token) (Node, error) {
+	end := strings.Index(value[1:], `"`)
+	if end < 0 {
+		return nil, parseErrorf(tok.pos, "unterminated phrase")
+	}
+	text, rest := value[1:end+1], value[end+2:]
+	// search "\"word1 word2\"~N" for words within N positions in any order
+	slop, sloppy := 0, false
+	if strings.HasPrefix(rest, "~") {
+		n, err := strconv.Atoi(rest[1:])
+		if err != nil || n < 0 {
+			return nil, parseErrorf(tok.pos, "invalid slop %s", rest[1:])
+		}
+		slop, sloppy, rest = n, true, ""
+	}
+	if rest != "" {
+		return nil, parseErrorf(tok.pos, "unexpected %q after phrase", rest)
+	}
+	return p.phrase(field, text, slop, sloppy), nil
+}
+
+// phrase tokenizes text into terms with their positions
+func (p *parser) phrase(field, text string, slop int, sloppy bool) Node {
+	var terms []string
+	var positions []int
+	for _, t := range p.index.Segmenter.Tokenize(text, false) {
+		terms = append(terms, t.Text)
+		positions = append(positions, t.Position)
+	}
+	switch len(terms) {
+	case 0:
+		return nil
+	case 1:
+		return &termQuery{field: field, text: text, terms: terms}
+	}
+	return &phraseQuery{
+		field:     field,
+		text:      `"` + text + `"`,
+		terms:     terms,
+		positions: positions,
+		sloppy:    sloppy,
+		slop:      slop,
+	}
+}
+
+// termClause analyzes text into terms, it's dropped if there are no terms, e.g. only stop words
+func (p *parser) termClause(field, text string) Node {
+	var terms []string
+	for _, term := range p.index.Segmenter.Analyze(text, false) {
+		if t := strings.TrimSpace(term); len(t) > 0 {
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	return &termQuery{field: field, text: text, terms: terms}
+}
+
+// compareClause parses value of number or date field to compare with
+func (p *parser) compareClause(field, operator, value string, tok token) (Node, error) {
+	ftype := p.index.FieldMeta[field]
+	num, err := parseNumeric(ftype, strings.Trim(value, `"`))
+	if err != nil {
+		if ftype == TDate {
+			return nil, parseErrorf(tok.pos, "invalid date %s", value)
+		}
+		return nil, parseErrorf(tok.pos, "invalid number %s", value)
+	}
+	op, ok := compareOperators[operator]
+	if !ok {
+		return nil, parseErrorf(tok.pos, "invalid operator %s", operator)
+	}
+	return &compareQuery{field: field, op: op, value: num}, nil
+}
+
+// rangeClause parses "[a TO b]" including bounds or "{a TO b}" excluding bounds, "*" means unbounded
+func (p *parser) rangeClause(field, value string, tok token) (Node, error) {
+	last := value[len(value)-1]
+	if len(value) == 1 || (last != ']' && last != '}') {
+		return nil, parseErrorf(tok.pos, "missing end of range")
+	}
+	bounds := strings.SplitN(value[1:len(value)-1], " TO ", 2)
+	if len(bounds) != 2 {
+		return nil, parseErrorf(tok.pos, "missing TO in range")
+	}
+	lower, upper := strings.TrimSpace(bounds[0]), strings.TrimSpace(bounds[1])
+	var nodes []Node
+	if lower != "*" {
+		operator := ">="
+		if value[0] == '{' {
+			operator = ">"
+		}
+		node, err := p.compareClause(field, operator, lower, tok)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if upper != "*" {
+		operator := "<="
+		if last == '}' {
+			operator = "<"
+		}
+		node, err := p.compareClause(field, operator, upper, tok)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return &existsQuery{field: field}, nil
+	}
+	return newBoolQuery(OperatorAnd, nodes), nil
+}
+
+// appendNode skips nil nodes which match nothing on their own
+func appendNode(nodes []Node, node Node) []Node {
+	if node == nil {
+		return nodes
+	}
+	return append(nodes, node)
+}
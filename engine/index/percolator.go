@@ -0,0 +1,471 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cosmtrek/violet/pkg/geo"
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// Percolator keeps standing queries of an index and finds the ones a document matches. Queries are indexed by
+// a few terms that a document must contain to match them, so only queries sharing terms with a document are checked.
+// Queries are saved into a json file next to the meta of index whenever they change.
+type Percolator struct {
+	index   *Index
+	queries map[string]*storedQuery
+	// terms maps a term to ids of queries requiring it, or one of other terms
+	terms map[string]map[string]bool
+	// unindexed are ids of queries requiring no term, e.g. filters only, which are checked for every document
+	unindexed map[string]bool
+	// lock guards queries and maps indexing them
+	lock sync.RWMutex
+}
+
+// storedQuery is a registered query with terms it's indexed by
+type storedQuery struct {
+	query string
+	root  Node
+	terms []string
+}
+
+func newPercolator(x *Index) *Percolator {
+	return &Percolator{
+		index:     x,
+		queries:   make(map[string]*storedQuery),
+		terms:     make(map[string]map[string]bool),
+		unindexed: make(map[string]bool),
+	}
+}
+
+// loadPercolator registers queries saved in the percolator file of index
+func loadPercolator(x *Index) (*Percolator, error) {
+	p := newPercolator(x)
+	file := percolatorFile(x.Path, x.Name)
+	if !utils.FileExists(file) {
+		return p, nil
+	}
+	data, err := utils.ReadJSON(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read json file")
+	}
+	var queries map[string]string
+	if err = json.Unmarshal(data, &queries); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal percolator queries")
+	}
+	for id, query := range queries {
+		stored, err := p.compile(query)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to compile query %s", id)
+		}
+		p.add(id, stored)
+	}
+	return p, nil
+}
+
+// Percolator returns the percolator of index
+func (x *Index) Percolator() *Percolator {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if x.percolator == nil {
+		x.percolator = newPercolator(x)
+	}
+	return x.percolator
+}
+
+// Register adds or replaces the query of id, the error is a *ParseError if query is invalid
+func (p *Percolator) Register(id string, query string) error {
+	if id == "" {
+		return errors.New("query id must not be empty")
+	}
+	p.index.lock.RLock()
+	stored, err := p.compile(query)
+	p.index.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	queries := p.storedQueries()
+	queries[id] = stored.query
+	if err = p.save(queries); err != nil {
+		return err
+	}
+	p.remove(id)
+	p.add(id, stored)
+	return nil
+}
+
+// compile parses query and finds terms it's indexed by, the caller holds the lock of index
+func (p *Percolator) compile(query string) (*storedQuery, error) {
+	q, err := NewQuery(p.index, query)
+	if err != nil {
+		return nil, errors.Cause(err)
+	}
+	if q.Root == nil {
+		return nil, errors.Errorf("query %s matches nothing", query)
+	}
+	stored := &storedQuery{query: q.Content, root: q.Root}
+	stored.terms, _ = requiredTerms(q.Root)
+	return stored, nil
+}
+
+func (p *Percolator) add(id string, stored *storedQuery) {
+	if len(stored.terms) == 0 {
+		p.unindexed[id] = true
+	}
+	for _, term := range stored.terms {
+		if p.terms[term] == nil {
+			p.terms[term] = make(map[string]bool)
+		}
+		p.terms[term][id] = true
+	}
+	p.queries[id] = stored
+}
+
+// Delete removes the query of id, returns false if it's not registered
+func (p *Percolator) Delete(id string) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.queries[id]; !ok {
+		return false, nil
+	}
+	queries := p.storedQueries()
+	delete(queries, id)
+	if err := p.save(queries); err != nil {
+		return false, err
+	}
+	return p.remove(id), nil
+}
+
+func (p *Percolator) remove(id string) bool {
+	stored, ok := p.queries[id]
+	if !ok {
+		return false
+	}
+	for _, term := range stored.terms {
+		delete(p.terms[term], id)
+		if len(p.terms[term]) == 0 {
+			delete(p.terms, term)
+		}
+	}
+	delete(p.unindexed, id)
+	delete(p.queries, id)
+	return true
+}
+
+// Queries returns registered queries by id
+func (p *Percolator) Queries() map[string]string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.storedQueries()
+}
+
+func (p *Percolator) storedQueries() map[string]string {
+	queries := make(map[string]string, len(p.queries))
+	for id, stored := range p.queries {
+		queries[id] = stored.query
+	}
+	return queries
+}
+
+// save writes queries into the percolator file of index
+func (p *Percolator) save(queries map[string]string) error {
+	if err := utils.WriteJSON(percolatorFile(p.index.Path, p.index.Name), queries); err != nil {
+		return errors.Wrap(err, "failed to save percolator queries")
+	}
+	return nil
+}
+
+// Percolate returns ids of queries the document matches in order
+func (p *Percolator) Percolate(doc map[string]string) []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if len(p.queries) == 0 {
+		return nil
+	}
+	d := p.index.newMemDoc(doc)
+	candidates := make(map[string]bool, len(p.unindexed))
+	for id := range p.unindexed {
+		candidates[id] = true
+	}
+	for _, positions := range d.terms {
+		for term := range positions {
+			for id := range p.terms[term] {
+				candidates[id] = true
+			}
+		}
+	}
+	var ids []string
+	for id := range candidates {
+		if d.match(p.queries[id].root) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Percolate returns ids of registered queries the document matches
+func (x *Index) Percolate(doc map[string]string) []string {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	return x.percolate(doc)
+}
+
+func (x *Index) percolate(doc map[string]string) []string {
+	if x.percolator == nil {
+		return nil
+	}
+	return x.percolator.Percolate(doc)
+}
+
+func percolatorFile(filepath, index string) string {
+	return fmt.Sprintf("%v/%v_percolator.json", filepath, index)
+}
+
+// requiredTerms returns terms that a doc must contain at least one of to match node, false if there are none
+func requiredTerms(node Node) ([]string, bool) {
+	switch n := node.(type) {
+	case *termQuery:
+		return longestTerm(n.terms)
+	case *phraseQuery:
+		return longestTerm(n.terms)
+	case *boostQuery:
+		return requiredTerms(n.child)
+	case *constantScoreQuery:
+		return requiredTerms(n.child)
+	case *functionScoreQuery:
+		return requiredTerms(n.child)
+	case *optionalQuery:
+		return requiredTerms(n.required)
+	case *boolQuery:
+		if n.op == OperatorOr {
+			var terms []string
+			for _, child := range n.children {
+				childTerms, ok := requiredTerms(child)
+				if !ok {
+					return nil, false
+				}
+				terms = append(terms, childTerms...)
+			}
+			return terms, true
+		}
+		// any required clause is enough, the fewer and longer terms the fewer docs to check
+		var best []string
+		for _, child := range n.children {
+			if _, ok := child.(*notQuery); ok {
+				continue
+			}
+			terms, ok := requiredTerms(child)
+			if !ok {
+				continue
+			}
+			if best == nil || len(terms) < len(best) || (len(terms) == len(best) && shortest(terms) > shortest(best)) {
+				best = terms
+			}
+		}
+		return best, best != nil
+	default:
+		return nil, false
+	}
+}
+
+// longestTerm returns the longest of terms which are all required, longer terms tend to be rarer
+func longestTerm(terms []string) ([]string, bool) {
+	if len(terms) == 0 {
+		return nil, false
+	}
+	longest := terms[0]
+	for _, term := range terms[1:] {
+		if len(term) > len(longest) {
+			longest = term
+		}
+	}
+	return []string{longest}, true
+}
+
+func shortest(terms []string) int {
+	min := len(terms[0])
+	for _, term := range terms[1:] {
+		if len(term) < min {
+			min = len(term)
+		}
+	}
+	return min
+}
+
+// memDoc is a document analyzed in memory to be matched by queries without indexing it
+type memDoc struct {
+	index  *Index
+	values map[string]string
+	// terms are positions of terms in each string field
+	terms map[string]map[string][]uint64
+}
+
+func (x *Index) newMemDoc(doc map[string]string) *memDoc {
+	d := &memDoc{index: x, values: doc, terms: make(map[string]map[string][]uint64)}
+	for name, ftype := range x.FieldMeta {
+		if ftype != TString || x.Fields[name] == nil || x.Fields[name].Deprecated {
+			continue
+		}
+		// analyzed in the same way as indexing
+		positions := make(map[string][]uint64)
+		for _, token := range x.Segmenter.Tokenize(doc[name], true) {
+			if t := strings.TrimSpace(token.Text); len(t) > 0 {
+				positions[t] = append(positions[t], uint64(token.Position))
+			}
+		}
+		d.terms[name] = positions
+	}
+	return d
+}
+
+// hasValue checks if field of doc has a valid value
+func (d *memDoc) hasValue(field string) bool {
+	f, ok := d.index.Fields[field]
+	return ok && !f.Deprecated && f.hasValue(d.values[field])
+}
+
+func (d *memDoc) match(node Node) bool {
+	switch n := node.(type) {
+	case *boolQuery:
+		for _, child := range n.children {
+			matched := d.match(child)
+			if n.op == OperatorOr && matched {
+				return true
+			}
+			if n.op != OperatorOr && !matched {
+				return false
+			}
+		}
+		return n.op != OperatorOr
+	case *notQuery:
+		return !d.match(n.child)
+	case *boostQuery:
+		return d.match(n.child)
+	case *constantScoreQuery:
+		return d.match(n.child)
+	case *functionScoreQuery:
+		return d.match(n.child)
+	case *optionalQuery:
+		return d.match(n.required)
+	case *matchAllQuery:
+		return true
+	case *termQuery:
+		return d.matchTerms(n)
+	case *phraseQuery:
+		return d.matchPhrase(n)
+	case *multiTermQuery:
+		for _, f := range d.index.searchFields(n.field, nil) {
+			for term := range d.terms[f.name] {
+				if n.match != nil && n.match(term) {
+					return true
+				}
+			}
+		}
+		return false
+	case *compareQuery:
+		if !d.hasValue(n.field) {
+			return false
+		}
+		value, err := parseNumeric(d.index.FieldMeta[n.field], d.values[n.field])
+		return err == nil && compareNumbers(value, n.value, n.op)
+	case *existsQuery:
+		return d.hasValue(n.field)
+	case *keywordQuery:
+		return d.hasValue(n.field) && strings.TrimSpace(d.values[n.field]) == n.value
+	case *geoQuery:
+		point, err := geo.ParsePoint(d.values[n.field])
+		return d.hasValue(n.field) && err == nil && n.shape.Contains(point)
+	case *ipQuery:
+		ip, err := parseIP(d.values[n.field])
+		if !d.hasValue(n.field) || err != nil {
+			return false
+		}
+		for _, block := range n.blocks {
+			if maskIP(ip, block.Prefix) == maskIP(block.IP, block.Prefix) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// matchTerms checks if every term is in any of fields, or all terms are in the same field in best_fields mode
+func (d *memDoc) matchTerms(t *termQuery) bool {
+	fields := d.index.searchFields(t.field, t.fields)
+	mode := t.mode
+	if mode == "" {
+		mode = d.index.MultiFieldMode
+	}
+	contains := func(fields []searchField, term string) bool {
+		for _, f := range fields {
+			if _, ok := d.terms[f.name][term]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	if mode == ModeBestFields && len(fields) > 1 {
+		for _, f := range fields {
+			matched := true
+			for _, term := range t.terms {
+				matched = matched && contains([]searchField{f}, term)
+			}
+			if matched {
+				return true
+			}
+		}
+		return false
+	}
+	for _, term := range t.terms {
+		if !contains(fields, term) {
+			return false
+		}
+	}
+	return len(t.terms) > 0
+}
+
+func (d *memDoc) matchPhrase(p *phraseQuery) bool {
+	terms := p.terms
+	if p.sloppy {
+		// the same term can't be matched at two places of a window
+		found := make(map[string]bool)
+		terms = nil
+		for _, term := range p.terms {
+			if !found[term] {
+				found[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return false
+	}
+	for _, f := range d.index.searchFields(p.field, nil) {
+		termPositions := make([][]uint64, len(terms))
+		missing := false
+		for i, term := range terms {
+			termPositions[i] = d.terms[f.name][term]
+			missing = missing || len(termPositions[i]) == 0
+		}
+		if missing {
+			continue
+		}
+		if p.sloppy {
+			if distance := sloppyDistance(termPositions); distance >= 0 && distance <= p.slop {
+				return true
+			}
+		} else if matchPhrase(termPositions, p.positions) {
+			return true
+		}
+	}
+	return false
+}
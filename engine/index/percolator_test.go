@@ -0,0 +1,112 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredTerms(t *testing.T) {
+	index := mockedIndex(t)
+	cases := []struct {
+		query    string
+		expected []string
+		ok       bool
+	}{
+		{"brady", []string{"brady"}, true},
+		{"tom brady", []string{"brady"}, true},
+		{"tom OR matt", []string{"tom", "matt"}, true},
+		{"super -bowl", []string{"super"}, true},
+		{`"super bowl" b>30`, []string{"super"}, true},
+		{"(tom OR matt) bowl", []string{"bowl"}, true},
+		{"tom OR b>30", nil, false},
+		{"-tom", nil, false},
+		{"brad*", nil, false},
+	}
+	for _, c := range cases {
+		q, err := NewQuery(index, c.query)
+		assert.Nil(t, err, c.query)
+		terms, ok := requiredTerms(q.Root)
+		assert.Equal(t, c.expected, terms, c.query)
+		assert.Equal(t, c.ok, ok, c.query)
+	}
+}
+
+func TestPercolator(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(map[string]uint64{"text": TString, "likes": TNumber, "client": TIP, "loc": TGeo}))
+
+	p := index.Percolator()
+	assert.Nil(t, p.Register("product", "violet -spam"))
+	assert.Nil(t, p.Register("popular", "likes>=100"))
+	assert.Nil(t, p.Register("phrase", `"super bowl"~1`))
+	assert.Nil(t, p.Register("fuzzy", "bardy~1 OR matt"))
+	assert.Nil(t, p.Register("office", "client:10.0.0.0/8 loc:within(39.9,116.4,10km)"))
+	assert.IsType(t, &ParseError{}, p.Register("bad", "(violet"))
+	assert.NotNil(t, p.Register("", "violet"))
+	assert.Equal(t, 5, len(p.Queries()))
+	assert.Equal(t, map[string]bool{"popular": true, "fuzzy": true, "office": true}, p.unindexed)
+
+	assert.Equal(t, []string{"product"}, index.Percolate(map[string]string{"text": "violet is fast"}))
+	assert.Nil(t, index.Percolate(map[string]string{"text": "violet spam"}))
+	assert.Equal(t, []string{"phrase", "popular"}, index.Percolate(map[string]string{"text": "bowl super", "likes": "120"}))
+	assert.Equal(t, []string{"fuzzy"}, index.Percolate(map[string]string{"text": "tom brady"}))
+	assert.Equal(t, []string{"office"}, index.Percolate(map[string]string{"client": "10.1.2.3", "loc": "39.91,116.41"}))
+	assert.Nil(t, index.Percolate(map[string]string{"client": "192.168.0.1", "loc": "39.91,116.41"}))
+
+	// replacing and deleting queries
+	assert.Nil(t, p.Register("product", "violet spam"))
+	assert.Equal(t, []string{"product"}, index.Percolate(map[string]string{"text": "violet spam"}))
+	deleted, err := p.Delete("product")
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	deleted, err = p.Delete("product")
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+	assert.Nil(t, index.Percolate(map[string]string{"text": "violet spam"}))
+	assert.Equal(t, 0, len(p.terms["violet"]))
+
+	var percolated []uint64
+	index.Percolated = func(docid uint64, ids []string) {
+		assert.Equal(t, []string{"popular"}, ids)
+		percolated = append(percolated, docid)
+	}
+	assert.Nil(t, index.AddDocument(map[string]string{"text": "nothing", "likes": "10"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"text": "nothing", "likes": "100"}))
+	assert.Equal(t, []uint64{1}, percolated)
+	ids, err := index.PercolateJSON([]byte(`{"text": "matt ryan", "likes": 1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fuzzy"}, ids)
+}
+
+func TestPercolator_Reload(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(map[string]uint64{"text": TString, "likes": TNumber}))
+	assert.Nil(t, index.Percolator().Register("product", "violet -spam"))
+	assert.Nil(t, index.Percolator().Register("popular", "likes>=100"))
+	assert.Nil(t, index.Percolator().Register("spam", "spam"))
+	deleted, err := index.Percolator().Delete("spam")
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+
+	// registered queries are reloaded with fields of the index
+	queries := map[string]string{"product": "violet -spam", "popular": "likes>=100"}
+	index, err = NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(map[string]uint64{"text": TString, "likes": TNumber}))
+	assert.Equal(t, queries, index.Percolator().Queries())
+	assert.Equal(t, []string{"popular", "product"}, index.Percolate(map[string]string{"text": "violet", "likes": "120"}))
+
+	assert.Nil(t, utils.WriteJSON(indexMetaFile(path, "violet"),
+		map[string]interface{}{"index": "violet", "path": path, "fields": map[string]uint64{"text": TString, "likes": TNumber}}))
+	index, err = NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Equal(t, queries, index.Percolator().Queries())
+}
@@ -1,10 +1,10 @@
 package index
 
 import (
-	"strconv"
+	"fmt"
+	"sort"
 	"strings"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 )
 
@@ -19,212 +19,566 @@ const (
 	GREATER
 	// EXCLUDE not contains this term
 	EXCLUDE
+	// NOTEQUAL !=
+	NOTEQUAL
+	// LESSEQUAL <=
+	LESSEQUAL
+	// GREATEREQUAL >=
+	GREATEREQUAL
 )
 
-// Filter on fields
-type Filter struct {
-	Field string
-	Value interface{}
-	Ftype uint64
+// compareOperators maps operators in query to compare types
+var compareOperators = map[string]uint64{
+	"=":  EQUAL,
+	"!=": NOTEQUAL,
+	"<":  LESS,
+	"<=": LESSEQUAL,
+	">":  GREATER,
+	">=": GREATEREQUAL,
 }
 
-// TermFilter small unit for query string
-type TermFilter struct {
-	Term   string
-	Filter Filter
-}
+const (
+	// ExistsField is the pseudo field of "_exists_:field" which matches docs having a value for field
+	ExistsField = "_exists_"
+)
 
 // Query for searching
 type Query struct {
-	Index   *Index
-	Content string
+	Index           *Index
+	Content         string
+	DefaultOperator string
+	Root            Node
 }
 
-// NewQuery initializes a query
+// NewQuery initializes a query and parses query string
 func NewQuery(index *Index, query string) (*Query, error) {
-	if index == nil || query == "" {
+	if index == nil {
 		return nil, errors.New("invalid params")
 	}
+	if strings.TrimSpace(query) == "" {
+		return nil, &ParseError{Reason: "empty query"}
+	}
 	q := &Query{
-		Index:   index,
-		Content: strings.TrimSpace(query),
+		Index:           index,
+		Content:         strings.TrimSpace(query),
+		DefaultOperator: index.DefaultOperator,
+	}
+	// positions of errors are in the original query
+	root, err := parseQuery(index, query, q.DefaultOperator)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse query")
 	}
+	q.Root = root
 	return q, nil
 }
 
 func (q *Query) do() ([]Doc, bool) {
-	termFilters, err := q.analyzeQuery()
-	if err != nil {
-		log.Error(err)
+	if q.Root == nil {
 		return nil, false
 	}
-	var wanted []TermFilter
-	var excluded []TermFilter
-	var numfiltered []TermFilter
-	for _, tf := range termFilters {
-		if tf.Filter.Ftype == EXCLUDE {
-			excluded = append(excluded, tf)
-			continue
+	docs := q.Root.search(q.Index)
+	if len(docs) == 0 {
+		return nil, false
+	}
+	// docs scoring the same keep in order of docid
+	sort.Stable(ScoreSort(docs))
+	return docs, true
+}
+
+// Node is a node of query syntax tree
+type Node interface {
+	// search returns docs matching the node in non-decreasing order
+	search(x *Index) []Doc
+	String() string
+}
+
+// filterNode checks docs one by one instead of looking up invert files, e.g. number filters
+type filterNode interface {
+	Node
+	match(x *Index, docid uint64) bool
+}
+
+// boolQuery combines clauses by AND or OR
+type boolQuery struct {
+	op       string
+	children []Node
+}
+
+// newBoolQuery returns the only child if there is just one
+func newBoolQuery(op string, children []Node) Node {
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	default:
+		return &boolQuery{op: op, children: children}
+	}
+}
+
+func (b *boolQuery) search(x *Index) []Doc {
+	if b.op == OperatorOr {
+		var docs []Doc
+		for _, child := range b.children {
+			docs, _ = MergeDocIDs(docs, child.search(x))
 		}
-		if tf.Filter.Ftype == LESS || tf.Filter.Ftype == EQUAL || tf.Filter.Ftype == GREATER {
-			numfiltered = append(numfiltered, tf)
+		return docs
+	}
+
+	var must, excluded []Node
+	var filters []filterNode
+	for _, child := range b.children {
+		if not, ok := child.(*notQuery); ok {
+			excluded = append(excluded, not.child)
+		} else if filter, ok := child.(filterNode); ok {
+			filters = append(filters, filter)
 		} else {
-			wanted = append(wanted, tf)
+			must = append(must, child)
 		}
 	}
 
 	var docs []Doc
-	for i := range wanted {
-		subdocs, found := q.search(wanted[i])
-		if found {
-			docs = append(docs, subdocs...)
-		}
-	}
-	for i := range excluded {
-		subdocs, found := q.search(excluded[i])
-		if found {
-			rest, found := ExcludeDocIDs(docs, subdocs)
-			if found {
-				docs = rest
+	switch {
+	case len(must) > 0:
+		for i, child := range must {
+			if i == 0 {
+				docs = child.search(x)
+			} else {
+				docs, _ = IntersectDocIDs(docs, child.search(x))
+			}
+			if len(docs) == 0 {
+				return nil
 			}
-			// TODO ignore error?
 		}
+	case len(filters) > 0:
+		docs = filters[0].search(x)
+		filters = filters[1:]
+	default:
+		// only exclusions, start from all docs
+		docs = x.allDocs()
 	}
-	if len(numfiltered) > 0 {
-		var ndocs []Doc
+	if len(filters) > 0 {
+		var filtered []Doc
 		for _, doc := range docs {
-			filtered := false
-			for _, f := range numfiltered {
-				value, ok := f.Filter.Value.(uint64)
-				if ok {
-					if !q.Index.Fields[f.Filter.Field].filter(doc.DocID, value, f.Filter.Ftype) {
-						filtered = true
-						break
-					}
+			passed := true
+			for _, f := range filters {
+				if !f.match(x, doc.DocID) {
+					passed = false
+					break
 				}
 			}
-			if !filtered {
-				ndocs = append(ndocs, doc)
+			if passed {
+				filtered = append(filtered, doc)
 			}
 		}
-		if len(ndocs) == 0 {
-			return nil, false
-		}
-		return ndocs, true
+		docs = filtered
 	}
-	return docs, true
+	for _, child := range excluded {
+		docs, _ = ExcludeDocIDs(docs, child.search(x))
+	}
+	return docs
 }
 
-func (q *Query) search(termFilter TermFilter) ([]Doc, bool) {
-	var docs []Doc
-	filter := termFilter.Filter
-	terms := q.Index.Segmenter.Analyze(termFilter.Term, false)
-	if filter.Field == "*" {
-		// no constraints
-		first := true
-		for _, term := range terms {
-			var subdocs []Doc
-			for k, v := range q.Index.FieldMeta {
-				if v == TString {
-					fieldDocs, ok := q.Index.SearchTerm(term, k)
-					if ok {
-						subdocs, _ = MergeDocIDs(subdocs, fieldDocs)
-					}
-				}
-			}
-			if first {
-				docs = subdocs
-				first = false
-			} else {
-				docs, _ = IntersectDocIDs(docs, subdocs)
-			}
+func (b *boolQuery) String() string {
+	clauses := make([]string, len(b.children))
+	for i, child := range b.children {
+		clauses[i] = child.String()
+	}
+	return "(" + strings.Join(clauses, " "+b.op+" ") + ")"
+}
+
+// notQuery excludes docs matching child
+type notQuery struct {
+	child Node
+}
+
+func (n *notQuery) search(x *Index) []Doc {
+	docs, _ := ExcludeDocIDs(x.allDocs(), n.child.search(x))
+	return docs
+}
+
+func (n *notQuery) String() string {
+	return "NOT " + n.child.String()
+}
+
+// boostQuery multiplies scores of child by boost
+type boostQuery struct {
+	child Node
+	boost float64
+}
+
+// newBoostQuery skips nil node which matches nothing
+func newBoostQuery(child Node, boost float64) Node {
+	if child == nil {
+		return nil
+	}
+	return &boostQuery{child: child, boost: boost}
+}
+
+func (b *boostQuery) search(x *Index) []Doc {
+	docs := b.child.search(x)
+	for i := range docs {
+		docs[i].Score *= b.boost
+	}
+	return docs
+}
+
+func (b *boostQuery) String() string {
+	return fmt.Sprintf("%s^%v", b.child.String(), b.boost)
+}
+
+// matchAllQuery matches all docs
+type matchAllQuery struct{}
+
+func (m *matchAllQuery) search(x *Index) []Doc {
+	return x.allDocs()
+}
+
+func (m *matchAllQuery) String() string {
+	return "*"
+}
+
+// constantScoreQuery matches docs of child without scoring them
+type constantScoreQuery struct {
+	child Node
+}
+
+func (c *constantScoreQuery) search(x *Index) []Doc {
+	docs := c.child.search(x)
+	for i := range docs {
+		docs[i].Score = 0
+	}
+	return docs
+}
+
+func (c *constantScoreQuery) String() string {
+	return c.child.String()
+}
+
+// optionalQuery matches docs of required, docs matching optional clauses as well score higher
+type optionalQuery struct {
+	required Node
+	optional []Node
+}
+
+func (o *optionalQuery) search(x *Index) []Doc {
+	docs := o.required.search(x)
+	for _, child := range o.optional {
+		addScores(docs, child.search(x))
+	}
+	return docs
+}
+
+func (o *optionalQuery) String() string {
+	clauses := make([]string, len(o.optional))
+	for i, child := range o.optional {
+		clauses[i] = child.String()
+	}
+	return o.required.String() + " SHOULD (" + strings.Join(clauses, " OR ") + ")"
+}
+
+// addScores adds scores of the same docs in b to a, both are in non-decreasing order
+func addScores(a, b []Doc) {
+	var i, j int
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].DocID == b[j].DocID:
+			a[i].Score += b[j].Score
+			i++
+			j++
+		case a[i].DocID < b[j].DocID:
+			i++
+		default:
+			j++
 		}
-		return docs, true
 	}
-	// search single field
-	first := true
-	// invalid field
-	ftype, ok := q.Index.FieldMeta[filter.Field]
-	if !ok {
-		return nil, false
+}
+
+// termQuery matches docs containing all terms analyzed from text, empty field means default search fields,
+// or fields given like "title^3" of which mode is "cross_fields" or "best_fields"
+type termQuery struct {
+	field  string
+	text   string
+	terms  []string
+	fields []string
+	mode   string
+}
+
+// textFields returns the string field, or default search fields if field is empty
+func textFields(x *Index, field string) []string {
+	var fields []string
+	for _, f := range x.searchFields(field, nil) {
+		fields = append(fields, f.name)
+	}
+	return fields
+}
+
+func (t *termQuery) search(x *Index) []Doc {
+	fields := x.searchFields(t.field, t.fields)
+	mode := t.mode
+	if mode == "" {
+		mode = x.MultiFieldMode
 	}
-	for _, term := range terms {
+	if mode == ModeBestFields && len(fields) > 1 {
+		var docs []Doc
+		for _, f := range fields {
+			docs = maxMergeDocIDs(docs, searchTerms(x, []searchField{f}, t.terms))
+		}
+		return docs
+	}
+	return searchTerms(x, fields, t.terms)
+}
+
+// searchTerms returns docs containing all terms in any of fields, a term scores by similarity of the best field containing it
+// times boost of the field, docs score the sum of terms
+func searchTerms(x *Index, fields []searchField, terms []string) []Doc {
+	var docs []Doc
+	for i, term := range terms {
 		var subdocs []Doc
-		if ftype == TString {
-			fieldDocs, ok := q.Index.SearchTerm(term, filter.Field)
+		for _, f := range fields {
+			field, ok := x.Fields[f.name]
+			if !ok {
+				continue
+			}
+			fieldDocs, ok := field.scoreTerm(term)
 			if ok {
-				subdocs, _ = MergeDocIDs(subdocs, fieldDocs)
+				for j := range fieldDocs {
+					fieldDocs[j].Score *= f.boost
+				}
+				subdocs = maxMergeDocIDs(subdocs, fieldDocs)
 			}
 		}
-		if first {
+		if i == 0 {
 			docs = subdocs
-			first = false
 		} else {
 			docs, _ = IntersectDocIDs(docs, subdocs)
 		}
+		if len(docs) == 0 {
+			return nil
+		}
 	}
-	return docs, true
+	return docs
+}
+
+func (t *termQuery) String() string {
+	if t.field == "" {
+		return t.text
+	}
+	return t.field + ":" + t.text
+}
+
+// phraseQuery matches docs containing terms in the same field at their relative positions,
+// or in any order within slop positions if it's sloppy
+type phraseQuery struct {
+	field     string
+	text      string
+	terms     []string
+	positions []int
+	sloppy    bool
+	slop      int
 }
 
-func (q *Query) analyzeQuery() ([]TermFilter, error) {
-	if len(q.Content) == 0 {
-		return nil, nil
-	}
-	segs := strings.Split(q.Content, " ")
-	var tfs []TermFilter
-	for _, seg := range segs {
-		tf := new(TermFilter)
-		// search "len>5"
-		operator, isCompare := HasCompare(seg)
-		if isCompare {
-			segkv := strings.Split(seg, operator)
-			tf.Term = segkv[0]
-			value, err := strconv.Atoi(segkv[1])
-			if err != nil {
-				// TODO handle error?
+func (p *phraseQuery) search(x *Index) []Doc {
+	var docs []Doc
+	for _, f := range x.searchFields(p.field, nil) {
+		field, ok := x.Fields[f.name]
+		if !ok {
+			continue
+		}
+		var fieldDocs []Doc
+		if p.sloppy {
+			fieldDocs, ok = field.searchSloppy(p.terms, p.slop)
+		} else {
+			fieldDocs, ok = field.searchPhrase(p.terms, p.positions)
+		}
+		if ok {
+			for i := range fieldDocs {
+				fieldDocs[i].Score *= f.boost
+			}
+			docs = maxMergeDocIDs(docs, fieldDocs)
+		}
+	}
+	return docs
+}
+
+func (p *phraseQuery) String() string {
+	text := p.text
+	if p.sloppy {
+		text = fmt.Sprintf("%s~%d", text, p.slop)
+	}
+	if p.field == "" {
+		return text
+	}
+	return p.field + ":" + text
+}
+
+// multiTermQuery matches docs containing any of terms expanded in each field, e.g. from a wildcard,
+// docs score the best of their terms, which is 1 or boost of the term if there is
+type multiTermQuery struct {
+	field string
+	text  string
+	// match checks terms not in dictionary when the query was parsed, e.g. of percolated docs
+	match      func(term string) bool
+	expansions map[string][]string
+	boosts     map[string]float64
+}
+
+func (m *multiTermQuery) search(x *Index) []Doc {
+	var docs []Doc
+	for _, f := range x.searchFields(m.field, nil) {
+		for _, term := range m.expansions[f.name] {
+			termDocs, ok := x.searchTerm(term, f.name)
+			if !ok {
 				continue
 			}
-			switch operator {
-			case "<":
-				tf.Filter = Filter{Field: tf.Term, Value: uint64(value), Ftype: LESS}
-			case "=":
-				tf.Filter = Filter{Field: tf.Term, Value: uint64(value), Ftype: EQUAL}
-			case ">":
-				tf.Filter = Filter{Field: tf.Term, Value: uint64(value), Ftype: GREATER}
-			default:
+			score := f.boost
+			if boost, ok := m.boosts[term]; ok {
+				score *= boost
 			}
-			if tf != nil {
-				tfs = append(tfs, *tf)
+			for i := range termDocs {
+				termDocs[i].Score = score
 			}
-			continue
+			docs = maxMergeDocIDs(docs, termDocs)
 		}
-		segkv := strings.Split(seg, ":")
-		if len(segkv) == 1 {
-			// search "-word"
-			if segkv[0][0] == '-' {
-				tf.Term = segkv[0][1:]
-				tf.Filter = Filter{Field: "*", Value: tf.Term, Ftype: EXCLUDE}
-			} else {
-				// search "word"
-				tf.Term = segkv[0]
-				tf.Filter = Filter{Field: "*", Value: tf.Term}
-			}
-		} else if len(segkv) == 2 {
-			// search "-field:word"
-			if segkv[0][0] == '-' {
-				tf.Term = segkv[0][1:]
-				tf.Filter = Filter{Field: tf.Term, Value: segkv[1], Ftype: EXCLUDE}
-			} else {
-				// search "field:word"
-				tf.Term = segkv[0]
-				tf.Filter = Filter{Field: tf.Term, Value: segkv[1]}
-			}
-		} else {
-			return nil, errors.New("failed to analyze query")
+	}
+	return docs
+}
+
+func (m *multiTermQuery) String() string {
+	if m.field == "" {
+		return m.text
+	}
+	return m.field + ":" + m.text
+}
+
+// compareQuery filters number or date field
+type compareQuery struct {
+	field string
+	op    uint64
+	value uint64
+}
+
+func (c *compareQuery) search(x *Index) []Doc {
+	field, ok := x.Fields[c.field]
+	if !ok {
+		return nil
+	}
+	var docs []Doc
+	for _, doc := range field.existDocs() {
+		if field.filter(doc.DocID, c.value, c.op) {
+			docs = append(docs, doc)
 		}
-		if tf != nil {
-			tfs = append(tfs, *tf)
+	}
+	return docs
+}
+
+func (c *compareQuery) match(x *Index, docid uint64) bool {
+	field, ok := x.Fields[c.field]
+	if !ok {
+		return false
+	}
+	return field.filter(docid, c.value, c.op)
+}
+
+func (c *compareQuery) String() string {
+	for operator, op := range compareOperators {
+		if op == c.op {
+			return fmt.Sprintf("%s%s%d", c.field, operator, c.value)
 		}
 	}
-	return tfs, nil
+	return c.field
+}
+
+// existsQuery matches docs having a value for field
+type existsQuery struct {
+	field string
+}
+
+func (e *existsQuery) search(x *Index) []Doc {
+	docs, _ := x.existDocs(e.field)
+	return docs
+}
+
+func (e *existsQuery) String() string {
+	return ExistsField + ":" + e.field
+}
+
+// keywordQuery matches docs whose keyword field has the value exactly
+type keywordQuery struct {
+	field string
+	value string
+}
+
+func (k *keywordQuery) search(x *Index) []Doc {
+	field, ok := x.Fields[k.field]
+	if !ok {
+		return nil
+	}
+	docs, _ := field.searchTerm(k.value)
+	return docs
+}
+
+func (k *keywordQuery) match(x *Index, docid uint64) bool {
+	field, ok := x.Fields[k.field]
+	if !ok || field.source == nil || field.source.docValues == nil {
+		return false
+	}
+	ord, ok := field.source.docValues.lookup(k.value)
+	if !ok {
+		return false
+	}
+	docOrd, ok := field.sortValue(docid)
+	return ok && docOrd == ord
+}
+
+func (k *keywordQuery) String() string {
+	if strings.ContainsAny(k.value, " \t") {
+		return fmt.Sprintf("%s:%q", k.field, k.value)
+	}
+	return k.field + ":" + k.value
+}
+
+// geoQuery matches docs whose location is in shape
+type geoQuery struct {
+	field string
+	shape *GeoShape
+}
+
+func (g *geoQuery) search(x *Index) []Doc {
+	field, ok := x.Fields[g.field]
+	if !ok {
+		return nil
+	}
+	docs, _ := field.searchGeo(g.shape)
+	return docs
+}
+
+func (g *geoQuery) String() string {
+	if g.shape.Circle {
+		return fmt.Sprintf("%s:within(%s,%vm)", g.field, g.shape.Center, g.shape.Radius)
+	}
+	return fmt.Sprintf("%s:box%s", g.field, g.shape.Box)
+}
+
+// ipQuery matches docs whose address is in any of blocks
+type ipQuery struct {
+	field  string
+	blocks []ipBlock
+}
+
+func (q *ipQuery) search(x *Index) []Doc {
+	field, ok := x.Fields[q.field]
+	if !ok {
+		return nil
+	}
+	docs, _ := field.searchIP(q.blocks)
+	return docs
+}
+
+func (q *ipQuery) String() string {
+	blocks := make([]string, len(q.blocks))
+	for i, b := range q.blocks {
+		blocks[i] = b.String()
+	}
+	return q.field + ":" + strings.Join(blocks, ",")
 }
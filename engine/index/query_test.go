@@ -0,0 +1,207 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestIndex creates an index of fields with docs added in order and synced to disk
+func newTestIndex(t *testing.T, fields map[string]uint64, docs ...map[string]string) *Index {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(fields))
+	for _, doc := range docs {
+		assert.Nil(t, index.AddDocument(doc))
+	}
+	assert.Nil(t, index.SyncToDisk())
+	return index
+}
+
+func mockedIndex(t *testing.T) *Index {
+	return newTestIndex(t, map[string]uint64{"a": TString, "b": TNumber},
+		map[string]string{"a": "tom brady super bowl", "b": "39"},
+		map[string]string{"a": "matt ryan super bowl", "b": "31"},
+		map[string]string{"a": "tom hanks movie", "b": "60"},
+		map[string]string{"a": "brady bunch movie"})
+}
+
+func TestQuery_do(t *testing.T) {
+	index := mockedIndex(t)
+	cases := []struct {
+		query    string
+		expected []uint64
+	}{
+		{"tom brady", []uint64{0}},
+		{"tom OR brady", []uint64{0, 2, 3}},
+		{"tom OR tom", []uint64{2, 0}},
+		{"tom AND NOT brady", []uint64{2}},
+		{"(tom OR matt) AND bowl", []uint64{1, 0}},
+		{"movie -(tom hanks)", []uint64{3}},
+		{"NOT movie", []uint64{0, 1}},
+		{"super b>35", []uint64{0}},
+		{"tom OR b<35", []uint64{2, 0, 1}},
+		{"a:(tom OR matt) -brady", []uint64{1, 2}},
+		{"b:60", []uint64{2}},
+		{"b>30 b<40", []uint64{0, 1}},
+		{"-_exists_:b", []uint64{3}},
+		{"tom AND (brady OR hanks) AND NOT bowl", []uint64{2}},
+		{"http://t.co/abc", nil},
+		{`"tom brady"`, []uint64{0}},
+		{`"brady tom"`, nil},
+		{`a:"super bowl" -"matt ryan"`, []uint64{0}},
+		{`"tom" OR "brady bunch"`, []uint64{3, 2, 0}},
+		{`"brady tom"~0`, []uint64{0}},
+		{"brad*", []uint64{0, 3}},
+		{"a:b?ady -bowl", []uint64{3}},
+		{"m*e", []uint64{2, 3}},
+		{"x*", nil},
+		{"bardy~1", []uint64{0, 3}},
+		{"/br[ae]dy/", []uint64{0, 3}},
+		{"a:/m(att|ovie)/ -hanks", []uint64{1, 3}},
+		{"a:/su.+ l/", nil},
+		{"a:tmo~ OR hanks", []uint64{2, 0}},
+		{"movi~1 OR movie~1", []uint64{2, 3}},
+		{`"bowl tom"~2 OR "movie brady"~1`, []uint64{3, 0}},
+		{"tom OR brady^2", []uint64{0, 3, 2}},
+		{"(tom OR matt)^0.5 OR movie", []uint64{2, 3, 1, 0}},
+		{`a:"tom hanks"^3 OR brady`, []uint64{2, 3, 0}},
+	}
+	for _, c := range cases {
+		q, err := NewQuery(index, c.query)
+		assert.Nil(t, err, c.query)
+		docs, found := q.do()
+		var actual []uint64
+		for _, doc := range docs {
+			actual = append(actual, doc.DocID)
+		}
+		assert.Equal(t, c.expected, actual, c.query)
+		assert.Equal(t, len(c.expected) > 0, found, c.query)
+	}
+}
+
+func TestQuery_Range(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(map[string]uint64{"title": TString, "score_1": TNumber, "created": TDate}))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "a", "score_1": "1", "created": "2020-01-01"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "b", "score_1": "5", "created": "2020-01-01 10:00:00"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "c", "score_1": "10", "created": "2020-06-01"}))
+	assert.Nil(t, index.AddDocument(map[string]string{"title": "d"}))
+	assert.Nil(t, index.SyncToDisk())
+
+	cases := []struct {
+		query    string
+		expected []uint64
+	}{
+		{"score_1>=5", []uint64{1, 2}},
+		{"score_1<=5", []uint64{0, 1}},
+		{"score_1!=5", []uint64{0, 2}},
+		{"score_1:[1 TO 5]", []uint64{0, 1}},
+		{"score_1:{1 TO 10}", []uint64{1}},
+		{"score_1:[5 TO *]", []uint64{1, 2}},
+		{"score_1:{* TO 5]", []uint64{0, 1}},
+		{"score_1:[* TO *]", []uint64{0, 1, 2}},
+		{"-score_1:[1 TO 5]", []uint64{2, 3}},
+		{"NOT score_1>1", []uint64{0, 3}},
+		{"score_1:(1 OR 10)", []uint64{0, 2}},
+		{"created:2020-01-01", []uint64{0, 1}},
+		{"created>2020-01-01", []uint64{1, 2}},
+		{`created:["2020-01-01 10:00:00" TO 2020-12-31]`, []uint64{1, 2}},
+		{"created:{2020-01-01 TO *}", []uint64{1, 2}},
+		{"created<2020-06-01 -score_1:1", []uint64{1}},
+	}
+	for _, c := range cases {
+		q, err := NewQuery(index, c.query)
+		assert.Nil(t, err, c.query)
+		docs, _ := q.do()
+		var actual []uint64
+		for _, doc := range docs {
+			actual = append(actual, doc.DocID)
+		}
+		assert.Equal(t, c.expected, actual, c.query)
+	}
+	for _, query := range []string{"score_1:[1 TO x]", "score_1:[1 5]", "score_1:[1 TO 5", "created>2020/01/01"} {
+		_, err := NewQuery(index, query)
+		assert.NotNil(t, err, query)
+	}
+	doc, ok := index.GetDocument(1)
+	assert.True(t, ok)
+	assert.Equal(t, "2020-01-01T10:00:00Z", doc["created"])
+}
+
+func TestQuery_DefaultOperator(t *testing.T) {
+	index := mockedIndex(t)
+	index.DefaultOperator = OperatorOr
+	docs, found := index.Search("tom matt")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{1, 2, 0}, docIDs(docs))
+	docs, found = index.Search("hanks matt AND tom")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{2}, docIDs(docs))
+	docs, found = index.Search("movie -tom")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{3}, docIDs(docs))
+	docs, found = index.Search("-tom movie")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{3}, docIDs(docs))
+	docs, found = index.Search("movie OR -tom")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{2, 3, 1}, docIDs(docs))
+	assert.Equal(t, float64(0), docs[2].Score)
+}
+
+func TestNewQuery_Invalid(t *testing.T) {
+	index := mockedIndex(t)
+	for _, query := range []string{"(tom", "tom)", "AND", "tom OR", "a:", "b>1x", "loc:(tom)", `"tom brady`, `"tom brady"~x`, `"tom brady"x`, "tom~3", "tom~x", "/.*dy/", "a:/br[/", "(tom)^x"} {
+		_, err := NewQuery(index, query)
+		assert.NotNil(t, err, query)
+	}
+	index.AllowRegexpScan = true
+	q, err := NewQuery(index, "/.*dy/")
+	assert.Nil(t, err)
+	docs, found := q.do()
+	assert.True(t, found)
+	assert.Equal(t, 2, len(docs))
+	q, err = NewQuery(index, "的")
+	assert.Nil(t, err)
+	_, found = q.do()
+	assert.False(t, found)
+}
+
+func TestIndex_ValidateQuery(t *testing.T) {
+	index := mockedIndex(t)
+	cases := []struct {
+		query  string
+		pos    int
+		reason string
+	}{
+		{"(tom", 0, "missing ')' for '('"},
+		{"tom OR", 6, "unexpected end of query"},
+		{"tom )", 4, "unexpected ')'"},
+		{"  b>1x", 2, "invalid number 1x"},
+		{`tom "brady`, 4, "unterminated phrase"},
+		{"", 0, "empty query"},
+	}
+	for _, c := range cases {
+		err := index.ValidateQuery(c.query)
+		assert.Equal(t, &ParseError{Pos: c.pos, Reason: c.reason}, err, c.query)
+		_, err = index.SearchQuery(c.query)
+		assert.IsType(t, &ParseError{}, err, c.query)
+	}
+	// values with ":" invalid for the field are searched as words, e.g. urls
+	for _, query := range []string{"tom", "b:http://t.co/abc", "b:1:2 OR tom"} {
+		assert.Nil(t, index.ValidateQuery(query), query)
+	}
+	docs, err := index.SearchQuery("b:1:2 OR tom")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(docs))
+	docs, err = index.SearchQuery("nothing")
+	assert.Nil(t, err)
+	assert.Nil(t, docs)
+}
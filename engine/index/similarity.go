@@ -0,0 +1,322 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SimilarityBM25 scores terms by BM25, the default of string fields
+	SimilarityBM25 = "bm25"
+	// SimilarityTFIDF scores terms by classic TF-IDF
+	SimilarityTFIDF = "tfidf"
+	// SimilarityConstant scores every matched term 1
+	SimilarityConstant = "constant"
+
+	// DefaultK1 is the default BM25 k1 of string fields
+	DefaultK1 = 1.2
+	// DefaultB is the default BM25 b of string fields
+	DefaultB = 0.75
+)
+
+// Similarity scores a term in a field of a doc, it's selected per string field. Scores must not decrease as freq grows
+// or increase as length grows, so that the highest frequency and the shortest length in posting lists bound scores of
+// docs skipped by top k search
+type Similarity interface {
+	// Name identifies the similarity in field meta, it must be registered to be loaded with the field
+	Name() string
+	// Score returns score of a term occurring freq times in the field of length terms
+	Score(stats TermStats, freq uint64, length uint32) float64
+	// Explain tells how the score adds up
+	Explain(stats TermStats, freq uint64, length uint32) *Explanation
+}
+
+// TermStats are statistics of a field and a term in it
+type TermStats struct {
+	// DocCount is the number of docs having terms in the field
+	DocCount uint64 `json:"doc_count"`
+	// DocFreq is the number of docs containing the term
+	DocFreq uint64 `json:"doc_freq"`
+	// AvgLength is the average length of the field in docs having terms in it
+	AvgLength float64 `json:"avg_length"`
+}
+
+var (
+	similaritiesMu sync.RWMutex
+	similarities   = map[string]func() Similarity{
+		SimilarityBM25:     func() Similarity { return &BM25Similarity{K1: DefaultK1, B: DefaultB} },
+		SimilarityTFIDF:    func() Similarity { return &TFIDFSimilarity{} },
+		SimilarityConstant: func() Similarity { return &ConstantSimilarity{} },
+	}
+)
+
+// RegisterSimilarity makes a similarity selectable by name, e.g. in schema of fields
+func RegisterSimilarity(name string, newSimilarity func() Similarity) {
+	similaritiesMu.Lock()
+	defer similaritiesMu.Unlock()
+	similarities[name] = newSimilarity
+}
+
+// NewSimilarity returns the similarity registered as name with default parameters
+func NewSimilarity(name string) (Similarity, error) {
+	similaritiesMu.RLock()
+	defer similaritiesMu.RUnlock()
+	newSimilarity, ok := similarities[name]
+	if !ok {
+		return nil, errors.Errorf("similarity %s not found", name)
+	}
+	return newSimilarity(), nil
+}
+
+// BM25Similarity saturates term frequency by K1 and normalizes it by length of the field against the average by B
+type BM25Similarity struct {
+	K1 float64
+	B  float64
+}
+
+// Name of BM25
+func (s *BM25Similarity) Name() string {
+	return SimilarityBM25
+}
+
+func (s *BM25Similarity) idf(stats TermStats) float64 {
+	return math.Log(1 + (float64(stats.DocCount)-float64(stats.DocFreq)+0.5)/(float64(stats.DocFreq)+0.5))
+}
+
+func (s *BM25Similarity) tfNorm(stats TermStats, freq uint64, length uint32) float64 {
+	norm := 1.0
+	if stats.AvgLength > 0 && length > 0 {
+		norm = 1 - s.B + s.B*float64(length)/stats.AvgLength
+	}
+	return float64(freq) * (s.K1 + 1) / (float64(freq) + s.K1*norm)
+}
+
+// Score is idf * tf * (k1 + 1) / (tf + k1 * (1 - b + b * dl / avgdl))
+func (s *BM25Similarity) Score(stats TermStats, freq uint64, length uint32) float64 {
+	return s.idf(stats) * s.tfNorm(stats, freq, length)
+}
+
+// Explain BM25 by idf and normalized tf
+func (s *BM25Similarity) Explain(stats TermStats, freq uint64, length uint32) *Explanation {
+	idf := &Explanation{
+		Clause:  "idf",
+		Matched: true,
+		Score:   s.idf(stats),
+		Description: fmt.Sprintf("ln(1 + (N - df + 0.5) / (df + 0.5)), N %d docs with field, df %d docs with term",
+			stats.DocCount, stats.DocFreq),
+	}
+	tf := &Explanation{
+		Clause:  "tf",
+		Matched: true,
+		Score:   s.tfNorm(stats, freq, length),
+		Description: fmt.Sprintf("tf * (k1 + 1) / (tf + k1 * (1 - b + b * dl / avgdl)), tf %d, k1 %v, b %v, dl %d, avgdl %v",
+			freq, s.K1, s.B, length, stats.AvgLength),
+	}
+	return &Explanation{
+		Matched:     true,
+		Score:       idf.Score * tf.Score,
+		Description: "BM25, idf times tf",
+		Details:     []*Explanation{idf, tf},
+	}
+}
+
+// TFIDFSimilarity scores by square root of term frequency, squared idf and inverse square root of length of the field
+type TFIDFSimilarity struct{}
+
+// Name of TF-IDF
+func (s *TFIDFSimilarity) Name() string {
+	return SimilarityTFIDF
+}
+
+func (s *TFIDFSimilarity) idf(stats TermStats) float64 {
+	return 1 + math.Log(float64(stats.DocCount+1)/float64(stats.DocFreq+1))
+}
+
+func (s *TFIDFSimilarity) norm(length uint32) float64 {
+	if length == 0 {
+		return 1
+	}
+	return 1 / math.Sqrt(float64(length))
+}
+
+// Score is sqrt(tf) * idf^2 / sqrt(dl)
+func (s *TFIDFSimilarity) Score(stats TermStats, freq uint64, length uint32) float64 {
+	idf := s.idf(stats)
+	return math.Sqrt(float64(freq)) * idf * idf * s.norm(length)
+}
+
+// Explain TF-IDF by tf, idf and norm of length
+func (s *TFIDFSimilarity) Explain(stats TermStats, freq uint64, length uint32) *Explanation {
+	tf := &Explanation{
+		Clause:      "tf",
+		Matched:     true,
+		Score:       math.Sqrt(float64(freq)),
+		Description: fmt.Sprintf("sqrt(tf), tf %d", freq),
+	}
+	idf := &Explanation{
+		Clause:  "idf",
+		Matched: true,
+		Score:   s.idf(stats),
+		Description: fmt.Sprintf("1 + ln((N + 1) / (df + 1)), N %d docs with field, df %d docs with term",
+			stats.DocCount, stats.DocFreq),
+	}
+	norm := &Explanation{
+		Clause:      "norm",
+		Matched:     true,
+		Score:       s.norm(length),
+		Description: fmt.Sprintf("1 / sqrt(dl), dl %d", length),
+	}
+	return &Explanation{
+		Matched:     true,
+		Score:       tf.Score * idf.Score * idf.Score * norm.Score,
+		Description: "TF-IDF, tf times idf squared times norm",
+		Details:     []*Explanation{tf, idf, norm},
+	}
+}
+
+// ConstantSimilarity scores every matched term 1, regardless of frequency and length
+type ConstantSimilarity struct{}
+
+// Name of constant score
+func (s *ConstantSimilarity) Name() string {
+	return SimilarityConstant
+}
+
+// Score is always 1
+func (s *ConstantSimilarity) Score(stats TermStats, freq uint64, length uint32) float64 {
+	return 1
+}
+
+// Explain constant score
+func (s *ConstantSimilarity) Explain(stats TermStats, freq uint64, length uint32) *Explanation {
+	return &Explanation{Matched: true, Score: 1, Description: "constant score"}
+}
+
+// SetSimilarity sets how terms of a string field score
+func (x *Index) SetSimilarity(name string, similarity Similarity) error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	field, ok := x.Fields[name]
+	if !ok {
+		return errors.Errorf("field %s not found", name)
+	}
+	if field.Type != TString {
+		return errors.Errorf("field %s is not a string field", name)
+	}
+	if similarity == nil {
+		return errors.Errorf("similarity of field %s must not be nil", name)
+	}
+	if bm25, ok := similarity.(*BM25Similarity); ok {
+		if bm25.K1 < 0 {
+			return errors.New("k1 must not be negative")
+		}
+		if bm25.B < 0 || bm25.B > 1 {
+			return errors.New("b must be between 0 and 1")
+		}
+		field.K1 = bm25.K1
+		field.B = bm25.B
+	}
+	field.Similarity = similarity.Name()
+	field.similarity = similarity
+	return nil
+}
+
+// SetBM25 scores a string field by BM25 of k1 and b, k1 limits how much term frequency counts,
+// b in [0, 1] is how much scores are normalized by length of the field
+func (x *Index) SetBM25(name string, k1, b float64) error {
+	return x.SetSimilarity(name, &BM25Similarity{K1: k1, B: b})
+}
+
+// newFieldSimilarity returns the similarity of field meta, BM25 by default with parameters of the field
+func newFieldSimilarity(f *Field) (Similarity, error) {
+	if f.Similarity == "" || f.Similarity == SimilarityBM25 {
+		return &BM25Similarity{K1: f.K1, B: f.B}, nil
+	}
+	return NewSimilarity(f.Similarity)
+}
+
+// avgLength returns the average length of the field in documents having terms in it
+func (f *Field) avgLength() float64 {
+	if f.DocCount == 0 {
+		return 0
+	}
+	return float64(f.SumLength) / float64(f.DocCount)
+}
+
+// termStats returns statistics of a term in docFreq docs of the field
+func (f *Field) termStats(docFreq uint64) TermStats {
+	docCount := f.DocCount
+	// documents indexed before lengths were recorded aren't counted
+	if docCount < docFreq {
+		docCount = docFreq
+	}
+	return TermStats{DocCount: docCount, DocFreq: docFreq, AvgLength: f.avgLength()}
+}
+
+// scoreTerm returns docs containing term scored by similarity of the field
+func (f *Field) scoreTerm(term string) ([]Doc, bool) {
+	if f.invert == nil {
+		return nil, false
+	}
+	pl, ok := f.invert.searchPostings(term)
+	if !ok {
+		return nil, false
+	}
+	stats := f.termStats(uint64(len(pl.docs)))
+	docs := make([]Doc, len(pl.docs))
+	for i, doc := range pl.docs {
+		docs[i] = Doc{DocID: doc.DocID, Score: f.similarity.Score(stats, pl.freq(i), f.norms.Get(doc.DocID))}
+	}
+	return docs, true
+}
+
+// scoreTerms multiplies scores of docs by the sum of scores of terms in them, e.g. of docs matching a phrase
+func (f *Field) scoreTerms(docs []Doc, terms []string) {
+	if f.invert == nil || len(docs) == 0 {
+		return
+	}
+	sums := make([]float64, len(docs))
+	for _, term := range terms {
+		pl, ok := f.invert.searchPostings(term)
+		if !ok {
+			continue
+		}
+		stats := f.termStats(uint64(len(pl.docs)))
+		for i, doc := range docs {
+			if j := pl.find(doc.DocID); j >= 0 {
+				sums[i] += f.similarity.Score(stats, pl.freq(j), f.norms.Get(doc.DocID))
+			}
+		}
+	}
+	for i := range docs {
+		docs[i].Score *= sums[i]
+	}
+}
+
+// explainScore explains score of a term in field of a doc by similarity of the field
+func explainScore(x *Index, f searchField, term string, docid uint64) *Explanation {
+	e := &Explanation{Clause: f.name + ":" + term}
+	field := x.Fields[f.name]
+	if field == nil || field.invert == nil {
+		e.Description = "term not found"
+		return e
+	}
+	pl, ok := field.invert.searchPostings(term)
+	if !ok {
+		e.Description = "term not found"
+		return e
+	}
+	i := pl.find(docid)
+	if i < 0 {
+		return e
+	}
+	se := field.similarity.Explain(field.termStats(uint64(len(pl.docs))), pl.freq(i), field.norms.Get(docid))
+	e.Matched = true
+	e.Score = se.Score * f.boost
+	e.Description = fmt.Sprintf("%s, times boost %v of field", se.Description, f.boost)
+	e.Details = se.Details
+	return e
+}
@@ -0,0 +1,136 @@
+package index
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func similarityIndex(t *testing.T) *Index {
+	return newTestIndex(t, map[string]uint64{"a": TString, "b": TNumber},
+		map[string]string{"a": "tom brady super bowl champion", "b": "1"},
+		map[string]string{"a": "tom tom tom brady", "b": "2"},
+		map[string]string{"a": "tom brady", "b": "3"},
+		map[string]string{"a": "matt ryan", "b": "4"},
+		map[string]string{"b": "5"})
+}
+
+func TestField_Stats(t *testing.T) {
+	index := similarityIndex(t)
+	field := index.Fields["a"]
+	assert.Equal(t, uint64(4), field.DocCount)
+	assert.Equal(t, uint64(13), field.SumLength)
+	assert.Equal(t, 3.25, field.avgLength())
+	assert.Equal(t, uint32(5), field.norms.Get(0))
+	assert.Equal(t, uint32(0), field.norms.Get(4))
+
+	// stats and lengths are loaded with the field
+	loaded, err := NewField("a", TString, field.Path, segmenter())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), loaded.DocCount)
+	assert.Equal(t, uint64(13), loaded.SumLength)
+	assert.Equal(t, uint32(4), loaded.norms.Get(1))
+	assert.Equal(t, DefaultK1, loaded.K1)
+}
+
+func TestField_ScoreTerm(t *testing.T) {
+	index := similarityIndex(t)
+	docs, ok := index.Fields["a"].scoreTerm("ryan")
+	assert.True(t, ok)
+	idf := math.Log(1 + (4-1+0.5)/(1+0.5))
+	tf := 1 * (DefaultK1 + 1) / (1 + DefaultK1*(1-DefaultB+DefaultB*2/3.25))
+	assert.Equal(t, 1, len(docs))
+	assert.InDelta(t, idf*tf, docs[0].Score, 1e-9)
+	_, ok = index.Fields["a"].scoreTerm("eagles")
+	assert.False(t, ok)
+}
+
+func TestIndex_Search_BM25(t *testing.T) {
+	index := similarityIndex(t)
+	// frequent terms score higher, then shorter fields
+	docs, found := index.Search("tom")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{1, 2, 0}, docIDs(docs))
+	// rare terms weigh more
+	docs, found = index.Search("tom OR ryan")
+	assert.True(t, found)
+	assert.Equal(t, uint64(3), docs[0].DocID)
+	docs, found = index.Search(`"tom brady"`)
+	assert.True(t, found)
+	assert.Equal(t, []uint64{1, 2, 0}, docIDs(docs))
+
+	// k1 of 0 ignores frequency and b of 0 ignores length
+	assert.Nil(t, index.SetBM25("a", 0, 0))
+	docs, found = index.Search("tom")
+	assert.True(t, found)
+	assert.Equal(t, []uint64{0, 1, 2}, docIDs(docs))
+	assert.Equal(t, docs[0].Score, docs[2].Score)
+	// frequency barely saturates with a large k1
+	assert.Nil(t, index.SetBM25("a", 100, 0))
+	docs, _ = index.Search("tom")
+	assert.Equal(t, []uint64{1, 0, 2}, docIDs(docs))
+
+	assert.Equal(t, SimilarityBM25, index.Fields["a"].Similarity)
+	assert.NotNil(t, index.SetBM25("b", 1.2, 0.75))
+	assert.NotNil(t, index.SetBM25("x", 1.2, 0.75))
+	assert.NotNil(t, index.SetBM25("a", -1, 0.75))
+	assert.NotNil(t, index.SetBM25("a", 1.2, 2))
+}
+
+// lengthSimilarity scores shorter fields higher regardless of terms
+type lengthSimilarity struct{}
+
+func (s *lengthSimilarity) Name() string { return "length" }
+
+func (s *lengthSimilarity) Score(stats TermStats, freq uint64, length uint32) float64 {
+	return 1 / float64(length)
+}
+
+func (s *lengthSimilarity) Explain(stats TermStats, freq uint64, length uint32) *Explanation {
+	return &Explanation{Matched: true, Score: s.Score(stats, freq, length), Description: "1 / dl"}
+}
+
+func TestIndex_SetSimilarity(t *testing.T) {
+	index := similarityIndex(t)
+	tfidf, err := NewSimilarity(SimilarityTFIDF)
+	assert.Nil(t, err)
+	assert.Nil(t, index.SetSimilarity("a", tfidf))
+	docs, found := index.Search("ryan")
+	assert.True(t, found)
+	idf := 1 + math.Log(5.0/2)
+	assert.InDelta(t, idf*idf/math.Sqrt(2), docs[0].Score, 1e-9)
+	e, err := index.Explain("ryan", 3)
+	assert.Nil(t, err)
+	assert.InDelta(t, docs[0].Score, e.Score, 1e-9)
+	fe := e.Details[0].Details[0]
+	assert.Equal(t, []string{"tf", "idf", "norm"}, []string{fe.Details[0].Clause, fe.Details[1].Clause, fe.Details[2].Clause})
+	docs, _ = index.Search("tom")
+	assert.Equal(t, []uint64{1, 2, 0}, docIDs(docs))
+
+	constant, err := NewSimilarity(SimilarityConstant)
+	assert.Nil(t, err)
+	assert.Nil(t, index.SetSimilarity("a", constant))
+	docs, _ = index.Search("tom")
+	assert.Equal(t, []Doc{{DocID: 0, Score: 1}, {DocID: 1, Score: 1}, {DocID: 2, Score: 1}}, docs)
+
+	// similarity is loaded with the field by its name
+	assert.Nil(t, index.SyncToDisk())
+	loaded, err := NewField("a", TString, index.Fields["a"].Path, segmenter())
+	assert.Nil(t, err)
+	assert.Equal(t, constant, loaded.similarity)
+
+	RegisterSimilarity("length", func() Similarity { return &lengthSimilarity{} })
+	assert.Nil(t, index.SetSimilarity("a", &lengthSimilarity{}))
+	docs, _ = index.Search("tom")
+	assert.Equal(t, []uint64{2, 1, 0}, docIDs(docs))
+	assert.Nil(t, index.SyncToDisk())
+	loaded, err = NewField("a", TString, index.Fields["a"].Path, segmenter())
+	assert.Nil(t, err)
+	assert.Equal(t, "length", loaded.similarity.Name())
+
+	_, err = NewSimilarity("none")
+	assert.NotNil(t, err)
+	assert.NotNil(t, index.SetSimilarity("b", constant))
+	assert.NotNil(t, index.SetSimilarity("a", nil))
+}
@@ -0,0 +1,245 @@
+package index
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SortScore sorts docs by score
+	SortScore = "_score"
+	// SortDoc sorts docs by docid, i.e. order of insertion
+	SortDoc = "_doc"
+	// MissingFirst puts docs lacking a sort field first
+	MissingFirst = "_first"
+	// MissingLast puts docs lacking a sort field last, which is the default
+	MissingLast = "_last"
+)
+
+// SortField is a key to sort docs, it's a field name, "_score" or "_doc",
+// docs lacking the field are put last unless missing is "_first"
+type SortField struct {
+	Field   string `json:"field"`
+	Desc    bool   `json:"desc"`
+	Missing string `json:"missing,omitempty"`
+}
+
+// UnmarshalJSON accepts "field", {"field": "desc"} or {"field": {"order": "desc", "missing": "_first"}}
+func (s *SortField) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		s.Field = name
+		// scores are sorted from high to low unless asked
+		s.Desc = name == SortScore
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) != 1 {
+		return errors.Errorf("invalid sort %s", data)
+	}
+	for field, raw := range fields {
+		var order string
+		if err := json.Unmarshal(raw, &order); err != nil {
+			var params struct {
+				Order   string `json:"order"`
+				Missing string `json:"missing"`
+			}
+			if err = json.Unmarshal(raw, &params); err != nil {
+				return errors.Errorf("invalid order of sort field %s", field)
+			}
+			order = params.Order
+			s.Missing = params.Missing
+			// order may be omitted with missing
+			if order == "" {
+				order = "asc"
+				if field == SortScore {
+					order = "desc"
+				}
+			}
+		}
+		if err := s.set(field, order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set sets field and order, and checks missing
+func (s *SortField) set(field, order string) error {
+	switch strings.ToLower(order) {
+	case "asc":
+		s.Desc = false
+	case "desc":
+		s.Desc = true
+	default:
+		return errors.Errorf("invalid order %s of sort field %s", order, field)
+	}
+	if s.Missing != "" && s.Missing != MissingFirst && s.Missing != MissingLast {
+		return errors.Errorf("invalid missing %s of sort field %s", s.Missing, field)
+	}
+	s.Field = field
+	return nil
+}
+
+// ParseSort parses sort fields like "created:desc,author:asc:_first,_score", in form of "field[:order[:missing]]",
+// order is "asc" by default or "desc" for "_score"
+func ParseSort(text string) ([]SortField, error) {
+	var fields []SortField
+	for _, spec := range strings.Split(text, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.Split(spec, ":")
+		if len(parts) > 3 || parts[0] == "" {
+			return nil, errors.Errorf("invalid sort %s", spec)
+		}
+		order := "asc"
+		if parts[0] == SortScore {
+			order = "desc"
+		}
+		if len(parts) > 1 && parts[1] != "" {
+			order = parts[1]
+		}
+		var f SortField
+		if len(parts) == 3 {
+			f.Missing = parts[2]
+		}
+		if err := f.set(parts[0], order); err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// sortValue is value of a doc for a sort field, ordinal of value for keyword fields,
+// or the value itself to compare docs with a cursor
+type sortValue struct {
+	num     uint64
+	score   float64
+	str     string
+	missing bool
+}
+
+// SortDocs sorts docs by fields one after another, by number, date or keyword fields with doc values
+func (x *Index) SortDocs(docs []Doc, fields []SortField) error {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	return x.sortDocs(docs, fields)
+}
+
+func (x *Index) sortDocs(docs []Doc, fields []SortField) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	for _, f := range fields {
+		if f.Field == SortScore || f.Field == SortDoc {
+			continue
+		}
+		field, ok := x.Fields[f.Field]
+		if !ok {
+			return errors.Errorf("field %s not found", f.Field)
+		}
+		if !isNumeric(field.Type) && field.Type != TKeyword {
+			return errors.Errorf("field %s can't be sorted", f.Field)
+		}
+	}
+
+	values := make(map[uint64][]sortValue, len(docs))
+	for _, doc := range docs {
+		row := make([]sortValue, len(fields))
+		for i, f := range fields {
+			switch f.Field {
+			case SortScore:
+				row[i].score = doc.Score
+			case SortDoc:
+				row[i].num = doc.DocID
+			default:
+				num, ok := x.Fields[f.Field].sortValue(doc.DocID)
+				row[i].num = num
+				row[i].missing = !ok
+			}
+		}
+		values[doc.DocID] = row
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, b := values[docs[i].DocID], values[docs[j].DocID]
+		for k, f := range fields {
+			if c := compareSortValues(a[k], b[k], f); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// compareSortValues returns -1 if a goes before b, 1 if after and 0 if they are equal
+func compareSortValues(a, b sortValue, f SortField) int {
+	if a.missing || b.missing {
+		c := 0
+		switch {
+		case a.missing && b.missing:
+			return 0
+		case a.missing:
+			c = 1
+		default:
+			c = -1
+		}
+		if f.Missing == MissingFirst {
+			return -c
+		}
+		return c
+	}
+	c := 0
+	switch {
+	case a.score < b.score, a.score == b.score && a.num < b.num, a.score == b.score && a.num == b.num && a.str < b.str:
+		c = -1
+	case a.score > b.score || a.num > b.num || a.str > b.str:
+		c = 1
+	}
+	if f.Desc {
+		return -c
+	}
+	return c
+}
+
+// SearchOptions tune how docs matching a query are returned
+type SearchOptions struct {
+	// Sort orders docs by fields one after another, by score if it's empty
+	Sort []SortField
+	// From skips the first docs, size limits the number of docs, 0 returns all of them
+	From int
+	Size int
+	// SearchAfter returns docs after the doc of the sort values, e.g. the last doc of the previous page
+	SearchAfter SortValues
+	// TrackTotalHits counts all matched docs instead of skipping the ones that can't rank in the page by score
+	TrackTotalHits bool
+	// Collapse keeps the top doc of each value of a keyword field
+	Collapse *Collapse
+	// Highlight marks matched terms in fragments of string fields of docs in the page
+	Highlight *Highlight
+}
+
+// SearchWithOptions returns a page of docs matching query ranked by score or sorted by fields,
+// the error is a *ParseError if query is invalid
+func (x *Index) SearchWithOptions(query string, opts SearchOptions) (*SearchResult, error) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	if opts.Size < 0 {
+		return nil, errors.New("size must not be negative")
+	}
+	q, err := NewQuery(x, query)
+	if err != nil {
+		return nil, errors.Cause(err)
+	}
+	if opts.Size == 0 {
+		opts.Size = -1
+	}
+	return x.searchNode(q.Root, opts)
+}
@@ -0,0 +1,88 @@
+package index
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortField_UnmarshalJSON(t *testing.T) {
+	var fields []SortField
+	assert.Nil(t, json.Unmarshal([]byte(`["_score", "b", {"c": "desc"}, {"d": {"order": "ASC"}},
+		{"e": {"missing": "_first"}}]`), &fields))
+	assert.Equal(t, []SortField{{Field: SortScore, Desc: true}, {Field: "b"}, {Field: "c", Desc: true}, {Field: "d"},
+		{Field: "e", Missing: MissingFirst}}, fields)
+	assert.NotNil(t, json.Unmarshal([]byte(`[{"c": "desc", "d": "asc"}]`), &fields))
+	assert.NotNil(t, json.Unmarshal([]byte(`[{"c": {"missing": "_middle"}}]`), &fields))
+}
+
+func TestParseSort(t *testing.T) {
+	fields, err := ParseSort("created:desc, author:asc:_first,_score,b::_last")
+	assert.Nil(t, err)
+	assert.Equal(t, []SortField{{Field: "created", Desc: true}, {Field: "author", Missing: MissingFirst},
+		{Field: SortScore, Desc: true}, {Field: "b", Missing: MissingLast}}, fields)
+	fields, err = ParseSort("")
+	assert.Nil(t, err)
+	assert.Nil(t, fields)
+	for _, text := range []string{"a:up", "a:asc:_middle", ":asc", "a:asc:_first:x"} {
+		_, err = ParseSort(text)
+		assert.NotNil(t, err, text)
+	}
+}
+
+func TestIndex_SortDocs(t *testing.T) {
+	index := mockedIndex(t)
+	docs := []Doc{{DocID: 0}, {DocID: 1}, {DocID: 2}, {DocID: 3}}
+	assert.Nil(t, index.SortDocs(docs, []SortField{{Field: "b"}}))
+	assert.Equal(t, []Doc{{DocID: 1}, {DocID: 0}, {DocID: 2}, {DocID: 3}}, docs)
+	docs = []Doc{{DocID: 0, Score: 1}, {DocID: 1, Score: 2}, {DocID: 2, Score: 1}}
+	assert.Nil(t, index.SortDocs(docs, []SortField{{Field: SortScore, Desc: true}, {Field: "b", Desc: true}}))
+	assert.Equal(t, []Doc{{DocID: 1, Score: 2}, {DocID: 2, Score: 1}, {DocID: 0, Score: 1}}, docs)
+	assert.NotNil(t, index.SortDocs(docs, []SortField{{Field: "x"}}))
+	assert.NotNil(t, index.SortDocs(docs, []SortField{{Field: "a"}}))
+}
+
+func tweetsIndex(t *testing.T) *Index {
+	return newTestIndex(t, map[string]uint64{"text": TString, "author": TKeyword, "created": TDate},
+		map[string]string{"text": "super bowl", "author": "tom", "created": "2018-02-04"},
+		map[string]string{"text": "super bowl champion", "author": "nick foles"},
+		map[string]string{"text": "super bowl", "author": "matt", "created": "2017-02-05"},
+		map[string]string{"text": "super bowl party", "created": "2019-02-03"})
+}
+
+func TestIndex_SearchWithOptions(t *testing.T) {
+	index := tweetsIndex(t)
+	cases := []struct {
+		sort     string
+		expected []uint64
+	}{
+		{"", []uint64{0, 2, 1, 3}},
+		{"created:desc", []uint64{3, 0, 2, 1}},
+		{"created:desc:_first", []uint64{1, 3, 0, 2}},
+		{"created", []uint64{2, 0, 3, 1}},
+		{"author", []uint64{2, 1, 0, 3}},
+		{"author:desc", []uint64{0, 1, 2, 3}},
+		{"author:asc:_first", []uint64{3, 2, 1, 0}},
+		{"_score,_doc:desc", []uint64{2, 0, 3, 1}},
+	}
+	for _, c := range cases {
+		fields, err := ParseSort(c.sort)
+		assert.Nil(t, err, c.sort)
+		result, err := index.SearchWithOptions("super", SearchOptions{Sort: fields})
+		assert.Nil(t, err, c.sort)
+		assert.Equal(t, c.expected, docIDs(result.Docs), c.sort)
+		assert.Equal(t, 4, result.Total, c.sort)
+
+		result, err = index.SearchWithOptions("super", SearchOptions{Sort: fields, Size: 2, TrackTotalHits: true})
+		assert.Nil(t, err, c.sort)
+		assert.Equal(t, c.expected[:2], docIDs(result.Docs), c.sort)
+		assert.Equal(t, 4, result.Total, c.sort)
+	}
+	_, err := index.SearchWithOptions("super", SearchOptions{Sort: []SortField{{Field: "text"}}})
+	assert.NotNil(t, err)
+	_, err = index.SearchWithOptions("(super", SearchOptions{})
+	assert.NotNil(t, err)
+	_, err = index.SearchWithOptions("super", SearchOptions{Size: -1})
+	assert.NotNil(t, err)
+}
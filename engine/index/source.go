@@ -1,9 +1,13 @@
 package index
 
 import (
+	"encoding/binary"
 	"fmt"
-	"strconv"
+	"math"
+	"net"
+	"strings"
 
+	"github.com/cosmtrek/violet/pkg/geo"
 	"github.com/cosmtrek/violet/pkg/io"
 	"github.com/cosmtrek/violet/pkg/utils"
 	"github.com/pkg/errors"
@@ -12,11 +16,14 @@ import (
 // Source holds documents in order
 type Source struct {
 	maxDocID  uint64
+	baseDocID uint64
 	filepath  string
 	field     string
 	fieldType uint64
 	handler   *io.Mmap
 	detail    *io.Mmap
+	// docValues are ordinals of keyword values to sort docs
+	docValues *docValues
 }
 
 // NewSource initialize source struct
@@ -32,7 +39,13 @@ func NewSource(filepath string, field string, fieldType uint64) (*Source, error)
 	detailFilename := fmt.Sprintf("%v%v.detail", filepath, field)
 
 	var err error
-	if fieldType == TString || fieldType == TStore {
+	if fieldType == TKeyword {
+		source.docValues = newDocValues()
+		if err = source.docValues.load(filepath, field); err != nil {
+			return nil, errors.Wrap(err, "failed to load doc values of keyword field")
+		}
+	}
+	if fieldType == TString || fieldType == TStore || fieldType == TKeyword {
 		if utils.FileExists(sourceFilename) && utils.FileExists(detailFilename) {
 			if source.handler, err = io.NewMmap(sourceFilename, io.ModeAppend); err != nil {
 				return nil, errors.Wrap(err, "failed to handle source file for string and store field in append mode")
@@ -50,7 +63,7 @@ func NewSource(filepath string, field string, fieldType uint64) (*Source, error)
 		}
 	}
 
-	if fieldType == TNumber {
+	if isNumeric(fieldType) || fieldType == TGeo || fieldType == TIP {
 		if utils.FileExists(sourceFilename) {
 			if source.handler, err = io.NewMmap(sourceFilename, io.ModeAppend); err != nil {
 				return nil, errors.Wrap(err, "failed to handle source file for number field in append mode")
@@ -67,7 +80,10 @@ func NewSource(filepath string, field string, fieldType uint64) (*Source, error)
 
 func (s *Source) addDocument(docid uint64, content string) error {
 	var err error
-	if s.fieldType == TString || s.fieldType == TStore {
+	if s.docValues != nil && strings.TrimSpace(content) != "" {
+		s.docValues.add(docid, strings.TrimSpace(content))
+	}
+	if s.fieldType == TString || s.fieldType == TStore || s.fieldType == TKeyword {
 		offset := uint64(s.detail.GetPointer())
 		if err = s.handler.AppendUint64(offset); err != nil {
 			return errors.Wrap(err, "failed to append offset to source file")
@@ -80,8 +96,8 @@ func (s *Source) addDocument(docid uint64, content string) error {
 		return nil
 	}
 
-	if s.fieldType == TNumber {
-		val, err := strconv.ParseUint(content, 10, 64)
+	if isNumeric(s.fieldType) {
+		val, err := parseNumeric(s.fieldType, content)
 		if err != nil {
 			val = 0
 		}
@@ -90,42 +106,122 @@ func (s *Source) addDocument(docid uint64, content string) error {
 		}
 		return nil
 	}
+
+	if s.fieldType == TGeo {
+		// lat and lon are stored as bits of float64
+		point, err := geo.ParsePoint(content)
+		if err != nil {
+			point = geo.Point{}
+		}
+		if err = s.handler.AppendUint64(math.Float64bits(point.Lat)); err != nil {
+			return errors.Wrap(err, "failed to append latitude to source file")
+		}
+		if err = s.handler.AppendUint64(math.Float64bits(point.Lon)); err != nil {
+			return errors.Wrap(err, "failed to append longitude to source file")
+		}
+		return nil
+	}
+
+	if s.fieldType == TIP {
+		// ip is stored as 16 bytes, IPv4 is mapped into IPv6
+		ip, err := parseIP(content)
+		if err != nil {
+			ip = [16]byte{}
+		}
+		if err = s.handler.AppendUint64(binary.BigEndian.Uint64(ip[:8])); err != nil {
+			return errors.Wrap(err, "failed to append ip to source file")
+		}
+		if err = s.handler.AppendUint64(binary.BigEndian.Uint64(ip[8:])); err != nil {
+			return errors.Wrap(err, "failed to append ip to source file")
+		}
+		return nil
+	}
 	return nil
 }
 
 func (s *Source) getDetail(docid uint64) interface{} {
-	offset := s.handler.ReadUint64(docid * 8)
-	if s.fieldType == TString || s.fieldType == TStore {
+	if s.fieldType == TGeo {
+		return s.getPoint(docid)
+	}
+	if s.fieldType == TIP {
+		return s.getIP(docid)
+	}
+	offset := s.handler.ReadUint64((docid - s.baseDocID) * 8)
+	if s.fieldType == TString || s.fieldType == TStore || s.fieldType == TKeyword {
 		return s.detail.ReadStringWithLen(offset)
 	}
 	return offset
 }
 
+// getPoint returns location of geo field
+func (s *Source) getPoint(docid uint64) geo.Point {
+	start := (docid - s.baseDocID) * 16
+	return geo.Point{
+		Lat: math.Float64frombits(s.handler.ReadUint64(start)),
+		Lon: math.Float64frombits(s.handler.ReadUint64(start + 8)),
+	}
+}
+
+// getIP returns address of ip field
+func (s *Source) getIP(docid uint64) net.IP {
+	start := (docid - s.baseDocID) * 16
+	ip := make(net.IP, 16)
+	binary.BigEndian.PutUint64(ip[:8], s.handler.ReadUint64(start))
+	binary.BigEndian.PutUint64(ip[8:], s.handler.ReadUint64(start+8))
+	return ip
+}
+
 // filter compares document's field value to user's
 func (s *Source) filter(docid, value, ftype uint64) bool {
 	if s.handler == nil {
 		return false
 	}
-	docVal := s.handler.ReadUint64(docid * 8)
+	return compareNumbers(s.handler.ReadUint64((docid-s.baseDocID)*8), value, ftype)
+}
+
+// compareNumbers compares value of doc with value of query by the compare type
+func compareNumbers(docVal, value, ftype uint64) bool {
 	switch ftype {
 	case EQUAL:
 		return docVal == value
+	case NOTEQUAL:
+		return docVal != value
 	case LESS:
 		return docVal < value
+	case LESSEQUAL:
+		return docVal <= value
 	case GREATER:
 		return docVal > value
+	case GREATEREQUAL:
+		return docVal >= value
 	default:
 		return false
 	}
 }
 
+// docValue returns value of number or date field, or ordinal of value of keyword field to sort docs
+func (s *Source) docValue(docid uint64) (uint64, bool) {
+	if s.docValues != nil {
+		return s.docValues.ord(docid)
+	}
+	if isNumeric(s.fieldType) {
+		return s.handler.ReadUint64((docid - s.baseDocID) * 8), true
+	}
+	return 0, false
+}
+
 func (s *Source) sync() error {
 	var err error
-	if s.fieldType == TString || s.fieldType == TStore {
+	if s.fieldType == TString || s.fieldType == TStore || s.fieldType == TKeyword {
 		if err = s.detail.Sync(); err != nil {
 			return err
 		}
 	}
+	if s.docValues != nil {
+		if err = s.docValues.save(s.filepath, s.field); err != nil {
+			return err
+		}
+	}
 	return s.handler.Sync()
 }
 
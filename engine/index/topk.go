@@ -0,0 +1,426 @@
+package index
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TotalEqual means the total of a search result is the number of matched docs
+	TotalEqual = "eq"
+	// TotalAtLeast means docs that can't rank in top k were skipped, the total is a lower bound of matched docs
+	TotalAtLeast = "gte"
+)
+
+// ranksBelow tells if doc a ranks below b by score, docs scoring the same rank in order of docid
+func ranksBelow(a, b Doc) bool {
+	return a.Score < b.Score || (a.Score == b.Score && a.DocID > b.DocID)
+}
+
+// docHeap is a min heap of docs, the lowest ranked doc is on top
+type docHeap []Doc
+
+func (h docHeap) Len() int            { return len(h) }
+func (h docHeap) Less(i, j int) bool  { return ranksBelow(h[i], h[j]) }
+func (h docHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *docHeap) Push(x interface{}) { *h = append(*h, x.(Doc)) }
+func (h *docHeap) Pop() interface{} {
+	old := *h
+	doc := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return doc
+}
+
+// topCollector keeps the k best docs in a bounded heap
+type topCollector struct {
+	k    int
+	docs docHeap
+}
+
+func newTopCollector(k int) *topCollector {
+	return &topCollector{k: k, docs: make(docHeap, 0, k)}
+}
+
+// collect keeps doc if it ranks above the lowest of k kept docs, which is dropped then
+func (c *topCollector) collect(doc Doc) {
+	switch {
+	case c.k <= 0:
+	case len(c.docs) < c.k:
+		heap.Push(&c.docs, doc)
+	case ranksBelow(c.docs[0], doc):
+		c.docs[0] = doc
+		heap.Fix(&c.docs, 0)
+	}
+}
+
+// threshold returns the score that docs collected in order of docid must exceed to be kept
+func (c *topCollector) threshold() float64 {
+	if len(c.docs) < c.k {
+		return math.Inf(-1)
+	}
+	return c.docs[0].Score
+}
+
+// sorted returns kept docs from the best
+func (c *topCollector) sorted() []Doc {
+	docs := make([]Doc, len(c.docs))
+	copy(docs, c.docs)
+	sort.Slice(docs, func(i, j int) bool { return ranksBelow(docs[j], docs[i]) })
+	return docs
+}
+
+// topDocs returns the k best docs matching node by score after the cursor if any, the number of matched docs, and
+// whether docs were skipped. A term, or a disjunction of terms, is searched by block-max WAND unless exact is true,
+// which skips docs whose max impacts in posting lists can't make them rank in top k, they aren't counted then.
+func (x *Index) topDocs(node Node, k int, after *cursor, exact bool) ([]Doc, int, bool) {
+	if !exact && k > 0 {
+		if clauses, ok := x.termClauses(node, nil); ok {
+			return x.searchWAND(clauses, k, after)
+		}
+	}
+	docs := node.search(x)
+	c := newTopCollector(k)
+	for _, doc := range docs {
+		if after == nil || after.follows(x, doc) {
+			c.collect(doc)
+		}
+	}
+	return c.sorted(), len(docs), false
+}
+
+// termClause is a term scoring by the best of fields containing it, times boosts one after another
+type termClause struct {
+	term   string
+	fields []searchField
+	boosts []float64
+}
+
+// termClauses flattens node into term clauses whose scores add up, if it's a term or a disjunction of terms
+func (x *Index) termClauses(node Node, boosts []float64) ([]termClause, bool) {
+	switch n := node.(type) {
+	case *termQuery:
+		if len(n.terms) != 1 {
+			return nil, false
+		}
+		return []termClause{{term: n.terms[0], fields: x.searchFields(n.field, n.fields), boosts: boosts}}, true
+	case *boostQuery:
+		// boosts of inner clauses apply first
+		return x.termClauses(n.child, append([]float64{n.boost}, boosts...))
+	case *boolQuery:
+		if n.op != OperatorOr {
+			return nil, false
+		}
+		var clauses []termClause
+		for _, child := range n.children {
+			childClauses, ok := x.termClauses(child, boosts)
+			if !ok {
+				return nil, false
+			}
+			clauses = append(clauses, childClauses...)
+		}
+		return clauses, true
+	default:
+		return nil, false
+	}
+}
+
+// fieldCursor walks the posting list of a term in a field
+type fieldCursor struct {
+	field *Field
+	boost float64
+	pl    *postingList
+	stats TermStats
+	i     int
+}
+
+func (c *fieldCursor) docid() uint64 {
+	if c.i >= len(c.pl.docs) {
+		return math.MaxUint64
+	}
+	return c.pl.docs[c.i].DocID
+}
+
+// advance moves to the first doc not less than target
+func (c *fieldCursor) advance(target uint64) {
+	docs := c.pl.docs[c.i:]
+	c.i += sort.Search(len(docs), func(i int) bool { return docs[i].DocID >= target })
+}
+
+func (c *fieldCursor) score() float64 {
+	return c.field.similarity.Score(c.stats, c.pl.freq(c.i), c.field.norms.Get(c.docid())) * c.boost
+}
+
+// bound returns the highest score of docs of impact m
+func (c *fieldCursor) bound(m impact) float64 {
+	return c.field.similarity.Score(c.stats, m.freq, m.length) * c.boost
+}
+
+// termCursor walks docs containing the term of a clause in any of its fields in order of docid
+type termCursor struct {
+	clause   int
+	fields   []*fieldCursor
+	boosts   []float64
+	maxScore float64
+}
+
+func (x *Index) newTermCursor(clause int, t termClause) *termCursor {
+	c := &termCursor{clause: clause, boosts: t.boosts}
+	for _, f := range t.fields {
+		field, ok := x.Fields[f.name]
+		if !ok || field.invert == nil {
+			continue
+		}
+		pl, ok := field.invert.searchPostings(t.term)
+		if !ok || len(pl.docs) == 0 {
+			continue
+		}
+		fc := &fieldCursor{field: field, boost: f.boost, pl: pl, stats: field.termStats(uint64(len(pl.docs)))}
+		if bound := fc.bound(pl.maxImpact()); bound > c.maxScore {
+			c.maxScore = bound
+		}
+		c.fields = append(c.fields, fc)
+	}
+	if len(c.fields) == 0 {
+		return nil
+	}
+	c.maxScore = c.boost(c.maxScore)
+	return c
+}
+
+func (c *termCursor) boost(score float64) float64 {
+	for _, b := range c.boosts {
+		score *= b
+	}
+	return score
+}
+
+// docid returns the current doc, or math.MaxUint64 if all docs are walked
+func (c *termCursor) docid() uint64 {
+	docid := uint64(math.MaxUint64)
+	for _, f := range c.fields {
+		if id := f.docid(); id < docid {
+			docid = id
+		}
+	}
+	return docid
+}
+
+func (c *termCursor) advance(target uint64) {
+	for _, f := range c.fields {
+		f.advance(target)
+	}
+}
+
+// score returns score of the current doc by the best field containing it
+func (c *termCursor) score() float64 {
+	docid := c.docid()
+	var score float64
+	for _, f := range c.fields {
+		if f.docid() == docid {
+			if s := f.score(); s > score {
+				score = s
+			}
+		}
+	}
+	return c.boost(score)
+}
+
+// blockMax returns the highest score of docs from target to the returned docid, by blocks of posting lists
+// containing the first doc not less than target
+func (c *termCursor) blockMax(target uint64) (float64, uint64) {
+	var score float64
+	end := uint64(math.MaxUint64)
+	for _, f := range c.fields {
+		docs := f.pl.docs[f.i:]
+		i := f.i + sort.Search(len(docs), func(i int) bool { return docs[i].DocID >= target })
+		if i >= len(f.pl.docs) {
+			continue
+		}
+		m, last := f.pl.blockImpact(i)
+		if s := f.bound(m); s > score {
+			score = s
+		}
+		if id := f.pl.docs[last].DocID; id < end {
+			end = id
+		}
+	}
+	return c.boost(score), end
+}
+
+// searchWAND collects the k best docs matching any of term clauses by block-max WAND. Cursors of clauses are kept
+// in order of docid, the pivot is the first doc which could exceed the threshold of top k by max scores of terms
+// up to it, docs before the pivot are skipped, and so are docs up to the end of blocks if max scores of blocks
+// can't exceed it either.
+func (x *Index) searchWAND(clauses []termClause, k int, after *cursor) ([]Doc, int, bool) {
+	var cursors []*termCursor
+	for i, clause := range clauses {
+		if c := x.newTermCursor(i, clause); c != nil {
+			cursors = append(cursors, c)
+		}
+	}
+	top := newTopCollector(k)
+	var matched int
+	var skipped bool
+	for {
+		sort.Slice(cursors, func(i, j int) bool { return cursors[i].docid() < cursors[j].docid() })
+		for len(cursors) > 0 && cursors[len(cursors)-1].docid() == math.MaxUint64 {
+			cursors = cursors[:len(cursors)-1]
+		}
+		if len(cursors) == 0 {
+			break
+		}
+
+		// docs come in order of docid, a doc scoring the same as the threshold ranks below kept docs
+		threshold := top.threshold()
+		pivot := -1
+		var sum float64
+		for i, c := range cursors {
+			sum += c.maxScore
+			if sum > threshold {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			skipped = true
+			break
+		}
+		docid := cursors[pivot].docid()
+		for pivot+1 < len(cursors) && cursors[pivot+1].docid() == docid {
+			pivot++
+		}
+
+		sum = 0
+		end := uint64(math.MaxUint64)
+		for _, c := range cursors[:pivot+1] {
+			score, last := c.blockMax(docid)
+			sum += score
+			if last < end {
+				end = last
+			}
+		}
+		if sum <= threshold {
+			// no doc can rank in top k until the end of the first block or the next cursor
+			next := end + 1
+			if pivot+1 < len(cursors) && cursors[pivot+1].docid() < next {
+				next = cursors[pivot+1].docid()
+			}
+			for _, c := range cursors[:pivot+1] {
+				c.advance(next)
+			}
+			skipped = true
+			continue
+		}
+
+		if cursors[0].docid() != docid {
+			// docs before the pivot contain only terms which can't make them rank in top k
+			for _, c := range cursors[:pivot] {
+				c.advance(docid)
+			}
+			skipped = true
+			continue
+		}
+
+		// scores of terms add up in order of clauses as the disjunction does
+		matching := cursors[:pivot+1]
+		sort.Slice(matching, func(i, j int) bool { return matching[i].clause < matching[j].clause })
+		doc := Doc{DocID: docid}
+		for _, c := range matching {
+			doc.Score += c.score()
+			c.advance(docid + 1)
+		}
+		matched++
+		if after == nil || after.follows(x, doc) {
+			top.collect(doc)
+		}
+	}
+	return top.sorted(), matched, skipped
+}
+
+// searchNode returns the page of docs from opts.From, or after the cursor of sort values, of opts.Size docs or all of
+// them if it's negative, docs are ranked by score or sorted by fields, collapsed by a field and highlighted if asked.
+// Docs may be skipped by top k search if sorted by score and total hits aren't tracked.
+func (x *Index) searchNode(root Node, opts SearchOptions) (*SearchResult, error) {
+	if opts.From < 0 {
+		return nil, errors.New("from must not be negative")
+	}
+	if opts.From > 0 && len(opts.SearchAfter) > 0 {
+		return nil, errors.New("from must be 0 to search after sort values")
+	}
+	if err := x.sortDocs(nil, opts.Sort); err != nil {
+		return nil, err
+	}
+	if err := x.checkCollapse(opts.Collapse); err != nil {
+		return nil, err
+	}
+	if err := x.checkHighlight(opts.Highlight); err != nil {
+		return nil, err
+	}
+	cur, err := x.newCursor(opts.Sort, opts.SearchAfter)
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchResult{TotalRelation: TotalEqual}
+	if root == nil {
+		return result, nil
+	}
+
+	var docs []Doc
+	var collapsed []*CollapsedHits
+	if opts.Size >= 0 && opts.Collapse == nil && sortsByScore(opts.Sort) {
+		var skipped bool
+		docs, result.Total, skipped = x.topDocs(root, opts.From+opts.Size, cur, opts.TrackTotalHits)
+		if skipped {
+			result.TotalRelation = TotalAtLeast
+		}
+	} else {
+		docs = root.search(x)
+		result.Total = len(docs)
+		// docs scoring the same keep in order of docid
+		sort.Stable(ScoreSort(docs))
+		if err = x.sortDocs(docs, opts.Sort); err != nil {
+			return nil, err
+		}
+		if opts.Collapse != nil {
+			docs, collapsed = x.collapse(docs, opts.Collapse)
+		}
+		if cur != nil {
+			i := sort.Search(len(docs), func(i int) bool { return cur.follows(x, docs[i]) })
+			docs = docs[i:]
+			if collapsed != nil {
+				collapsed = collapsed[i:]
+			}
+		}
+	}
+	if opts.From >= len(docs) {
+		return result, nil
+	}
+	end := len(docs)
+	if opts.Size >= 0 && opts.From+opts.Size < end {
+		end = opts.From + opts.Size
+	}
+	result.Docs = docs[opts.From:end]
+	if collapsed != nil {
+		result.Collapsed = collapsed[opts.From:end]
+	}
+	if opts.Highlight != nil {
+		result.Highlights = x.highlight(root, result.Docs, opts.Highlight)
+	}
+	return result, nil
+}
+
+// sortsByScore tells if fields rank docs by score, then by docid
+func sortsByScore(fields []SortField) bool {
+	switch len(fields) {
+	case 0:
+		return true
+	case 1:
+		return fields[0].Field == SortScore && fields[0].Desc
+	default:
+		return len(fields) == 2 && fields[0].Field == SortScore && fields[0].Desc &&
+			fields[1].Field == SortDoc && !fields[1].Desc
+	}
+}
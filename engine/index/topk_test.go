@@ -0,0 +1,112 @@
+package index
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopCollector(t *testing.T) {
+	c := newTopCollector(3)
+	for _, doc := range []Doc{{0, 1}, {1, 3}, {2, 2}, {3, 1}, {4, 3}, {5, 0.5}} {
+		c.collect(doc)
+	}
+	assert.Equal(t, []Doc{{1, 3}, {4, 3}, {2, 2}}, c.sorted())
+	assert.Equal(t, 2.0, c.threshold())
+	assert.Empty(t, newTopCollector(0).sorted())
+}
+
+func TestEncodePostings_Impacts(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	invert, err := NewInvert(path, "text", TString, segmenter())
+	assert.Nil(t, err)
+	for i := 0; i < PostingBlockSize+10; i++ {
+		text := "tom brady"
+		switch i {
+		case 3:
+			text = "tom tom tom brady super bowl"
+		case PostingBlockSize + 5:
+			text = "tom tom"
+		}
+		_, err = invert.addDocument(uint64(i), text)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, invert.saveTmpInvert())
+	assert.Nil(t, invert.mergeTmpInvert())
+
+	pl, ok := invert.searchPostings("tom")
+	assert.True(t, ok)
+	assert.Equal(t, impact{freq: 3, length: 2}, pl.maxImpact())
+	m, last := pl.blockImpact(3)
+	assert.Equal(t, impact{freq: 3, length: 2}, m)
+	assert.Equal(t, PostingBlockSize-1, last)
+	m, last = pl.blockImpact(PostingBlockSize)
+	assert.Equal(t, impact{freq: 2, length: 2}, m)
+	assert.Equal(t, PostingBlockSize+9, last)
+	assert.Equal(t, []uint64{0, 1, 2}, pl.positions(3))
+}
+
+func TestIndex_topDocs(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	index, err := NewIndex(path, "violet", segmenter())
+	assert.Nil(t, err)
+	assert.Nil(t, index.IndexFields(map[string]uint64{"title": TString, "text": TString}))
+	words := []string{"tom", "brady", "super", "bowl", "matt", "ryan", "party", "movie"}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		var title, text []string
+		for j := 0; j < 1+r.Intn(4); j++ {
+			title = append(title, words[r.Intn(len(words))])
+		}
+		for j := 0; j < 1+r.Intn(20); j++ {
+			// common words are more likely
+			text = append(text, words[r.Intn(1+r.Intn(len(words)))])
+		}
+		assert.Nil(t, index.AddDocument(map[string]string{"title": strings.Join(title, " "), "text": strings.Join(text, " ")}))
+	}
+	assert.Nil(t, index.SyncToDisk())
+	assert.Nil(t, index.SetDefaultFields([]string{"title^2", "text"}))
+
+	var skipped bool
+	for _, query := range []string{"tom", "text:tom", "tom OR movie", "tom OR brady OR super OR party",
+		"(tom OR ryan^3)^0.5 OR text:movie", "tom OR tom", "text:tom OR title:tom", "brady OR nothing"} {
+		all, err := index.SearchQuery(query)
+		assert.Nil(t, err, query)
+		q, err := NewQuery(index, query)
+		assert.Nil(t, err, query)
+		for _, k := range []int{1, 10, 50} {
+			docs, total, ok := index.topDocs(q.Root, k, nil, false)
+			assert.Equal(t, docIDs(all[:k]), docIDs(docs), query)
+			for i := range docs {
+				assert.InDelta(t, all[i].Score, docs[i].Score, 1e-9, query)
+			}
+			assert.True(t, total <= len(all), query)
+			if ok {
+				skipped = true
+			} else {
+				assert.Equal(t, len(all), total, query)
+			}
+
+			docs, total, ok = index.topDocs(q.Root, k, nil, true)
+			assert.Equal(t, all[:k], docs, query)
+			assert.Equal(t, len(all), total, query)
+			assert.False(t, ok, query)
+		}
+	}
+	assert.True(t, skipped)
+
+	// disjunctions of terms only are pruned
+	q, err := NewQuery(index, "tom AND brady")
+	assert.Nil(t, err)
+	_, ok := index.termClauses(q.Root, nil)
+	assert.False(t, ok)
+	q, err = NewQuery(index, "tom OR -brady")
+	assert.Nil(t, err)
+	_, ok = index.termClauses(q.Root, nil)
+	assert.False(t, ok)
+}
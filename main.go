@@ -52,7 +52,17 @@ func main() {
 			w.Write([]byte("ok"))
 		})
 		r.Post("/index", handler.IndexHandler)
+		r.Post("/:indexer/fields", handler.FieldsHandler)
+		r.Post("/:indexer/fields/:field/deprecate", handler.DeprecateFieldHandler)
+		r.Post("/:indexer/_doc", handler.DocumentHandler)
+		r.Post("/:indexer/_refresh", handler.RefreshHandler)
 		r.Get("/:indexer/search", handler.SearchHandler)
+		r.Post("/:indexer/_search", handler.SearchDSLHandler)
+		r.Get("/:indexer/_explain/:docid", handler.ExplainHandler)
+		r.Get("/:indexer/_validate", handler.ValidateHandler)
+		r.Put("/:indexer/_percolator/:id", handler.RegisterQueryHandler)
+		r.Delete("/:indexer/_percolator/:id", handler.DeleteQueryHandler)
+		r.Post("/:indexer/_percolate", handler.PercolateHandler)
 		log.Fatal(http.ListenAndServe(":"+serverPort, r))
 	}
 
@@ -101,9 +111,11 @@ func main() {
 			if term == "q" || term == "quit" {
 				break
 			}
-			docs, ok := indexer.Search(index, term)
+			docs, err := indexer.Search(index, term)
 			fmt.Println("~ results ")
-			if ok {
+			if err != nil {
+				fmt.Println(err)
+			} else if len(docs) > 0 {
 				for i, d := range docs {
 					fmt.Printf("%d, %s at %s\n", i, d["tweet"], d["date"])
 				}
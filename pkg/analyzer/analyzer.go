@@ -2,6 +2,7 @@ package analyzer
 
 import (
 	"os"
+	"strings"
 
 	"github.com/huichen/sego"
 	"github.com/pkg/errors"
@@ -14,6 +15,16 @@ const (
 // Analyzer exposed
 type Analyzer interface {
 	Analyze(text string, searchMode bool) []string
+	Tokenize(text string, searchMode bool) []Token
+}
+
+// Token is a valid word with its position and byte offsets in text
+type Token struct {
+	Text string
+	// Position counts valid words, words split from a longer word in search mode share its position
+	Position int
+	Start    int
+	End      int
 }
 
 // Segmenter is used to segment words
@@ -53,3 +64,45 @@ func (s *Segmenter) Analyze(text string, searchModel bool) []string {
 	}
 	return validSegs
 }
+
+// Tokenize returns valid words with their positions and byte offsets
+func (s *Segmenter) Tokenize(text string, searchMode bool) []Token {
+	if text == "" {
+		return []Token{}
+	}
+	var tokens []Token
+	position := 0
+	for _, seg := range s.handler.Segment([]byte(text)) {
+		word := seg.Token().Text()
+		if _, ok := s.stopword[word]; ok || strings.TrimSpace(word) == "" {
+			continue
+		}
+		if searchMode {
+			tokens = s.appendSubTokens(tokens, seg.Token(), position, seg.Start())
+		}
+		tokens = append(tokens, Token{Text: word, Position: position, Start: seg.Start(), End: seg.End()})
+		position++
+	}
+	return tokens
+}
+
+// appendSubTokens appends shorter words of token like sego.SegmentsToSlice does in search mode
+func (s *Segmenter) appendSubTokens(tokens []Token, token *sego.Token, position int, start int) []Token {
+	onlyTerminal := true
+	for _, seg := range token.Segments() {
+		if len(seg.Token().Segments()) > 1 {
+			onlyTerminal = false
+		}
+	}
+	if onlyTerminal {
+		return tokens
+	}
+	for _, seg := range token.Segments() {
+		tokens = s.appendSubTokens(tokens, seg.Token(), position, start+seg.Start())
+		word := seg.Token().Text()
+		if _, ok := s.stopword[word]; !ok {
+			tokens = append(tokens, Token{Text: word, Position: position, Start: start + seg.Start(), End: start + seg.End()})
+		}
+	}
+	return tokens
+}
@@ -19,3 +19,19 @@ func TestAnalyze(t *testing.T) {
 	expected2 := []string{"violet", "is", "a", "search", "engine", "in", "go"}
 	assert.Equal(t, expected2, termsWithSearch)
 }
+
+func TestTokenize(t *testing.T) {
+	segmenter, err := New()
+	assert.NotNil(t, segmenter)
+	assert.Nil(t, err)
+
+	tokens := segmenter.Tokenize("Tom Brady, the GOAT!", false)
+	expected := []Token{
+		{Text: "tom", Position: 0, Start: 0, End: 3},
+		{Text: "brady", Position: 1, Start: 4, End: 9},
+		{Text: "the", Position: 2, Start: 11, End: 14},
+		{Text: "goat", Position: 3, Start: 15, End: 19},
+	}
+	assert.Equal(t, expected, tokens)
+	assert.Equal(t, []Token{}, segmenter.Tokenize("", true))
+}
@@ -0,0 +1,221 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// EarthRadius in meters
+	EarthRadius = 6371008.8
+	base32      = "0123456789bcdefghjkmnpqrstuvwxyz"
+	// MaxPrecision is the max length of geohash
+	MaxPrecision = 12
+)
+
+// Point is a location on earth
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Box is a rectangle area on earth, Left may be greater than Right when crossing the 180th meridian
+type Box struct {
+	Top    float64
+	Left   float64
+	Bottom float64
+	Right  float64
+}
+
+// ParsePoint parses "lat,lon"
+func ParsePoint(text string) (Point, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 2 {
+		return Point{}, errors.Errorf("invalid point %s", text)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return Point{}, errors.Wrap(err, "invalid latitude")
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return Point{}, errors.Wrap(err, "invalid longitude")
+	}
+	p := Point{Lat: lat, Lon: lon}
+	if !p.Valid() {
+		return Point{}, errors.Errorf("point %s out of range", text)
+	}
+	return p, nil
+}
+
+// Valid checks if latitude and longitude are in range
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+func (p Point) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lon, 'f', -1, 64)
+}
+
+// Contains checks if the point is in box
+func (b Box) Contains(p Point) bool {
+	if p.Lat > b.Top || p.Lat < b.Bottom {
+		return false
+	}
+	if b.Left <= b.Right {
+		return p.Lon >= b.Left && p.Lon <= b.Right
+	}
+	return p.Lon >= b.Left || p.Lon <= b.Right
+}
+
+// ParseDistance parses distance like "10km", "500m" or "3mi" into meters, meters is the default unit
+func ParseDistance(text string) (float64, error) {
+	text = strings.TrimSpace(text)
+	unit := 1.0
+	switch {
+	case strings.HasSuffix(text, "km"):
+		unit, text = 1000, strings.TrimSuffix(text, "km")
+	case strings.HasSuffix(text, "mi"):
+		unit, text = 1609.344, strings.TrimSuffix(text, "mi")
+	case strings.HasSuffix(text, "m"):
+		text = strings.TrimSuffix(text, "m")
+	}
+	d, err := strconv.ParseFloat(text, 64)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("invalid distance %s", text)
+	}
+	return d * unit, nil
+}
+
+// Distance returns the great-circle distance in meters between two points
+func Distance(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dlat := (b.Lat - a.Lat) * math.Pi / 180
+	dlon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// CircleBox returns the bounding box of a circle
+func CircleBox(center Point, radius float64) Box {
+	dlat := radius / EarthRadius * 180 / math.Pi
+	box := Box{
+		Top:    math.Min(90, center.Lat+dlat),
+		Bottom: math.Max(-90, center.Lat-dlat),
+		Left:   -180,
+		Right:  180,
+	}
+	// the circle covers a pole, so all longitudes
+	if box.Top == 90 || box.Bottom == -90 {
+		return box
+	}
+	dlon := math.Asin(math.Min(1, math.Sin(radius/EarthRadius)/math.Cos(center.Lat*math.Pi/180))) * 180 / math.Pi
+	if dlon >= 180 {
+		return box
+	}
+	box.Left = normalizeLon(center.Lon - dlon)
+	box.Right = normalizeLon(center.Lon + dlon)
+	return box
+}
+
+func normalizeLon(lon float64) float64 {
+	if lon < -180 {
+		return lon + 360
+	}
+	if lon > 180 {
+		return lon - 360
+	}
+	return lon
+}
+
+// Encode returns geohash of a point
+func Encode(p Point, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	even := true
+	var bit, ch int
+	for len(hash) < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if p.Lon >= mid {
+				ch |= 1 << uint(4-bit)
+				lonRange[0] = mid
+			} else {
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if p.Lat >= mid {
+				ch |= 1 << uint(4-bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+		} else {
+			hash = append(hash, base32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// CellSize returns height and width in degrees of geohash cells of precision
+func CellSize(precision int) (float64, float64) {
+	bits := uint(precision * 5)
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / float64(uint64(1)<<latBits), 360 / float64(uint64(1)<<lonBits)
+}
+
+// Cover returns geohash cells of precision that cover the box
+func Cover(box Box, precision int) []string {
+	if box.Left > box.Right {
+		west := Cover(Box{Top: box.Top, Left: box.Left, Bottom: box.Bottom, Right: 180}, precision)
+		east := Cover(Box{Top: box.Top, Left: -180, Bottom: box.Bottom, Right: box.Right}, precision)
+		return append(west, east...)
+	}
+	height, width := CellSize(precision)
+	var cells []string
+	for lat := math.Floor((box.Bottom+90)/height)*height - 90; lat <= box.Top && lat < 90; lat += height {
+		for lon := math.Floor((box.Left+180)/width)*width - 180; lon <= box.Right && lon < 180; lon += width {
+			cells = append(cells, Encode(Point{Lat: lat + height/2, Lon: lon + width/2}, precision))
+		}
+	}
+	return cells
+}
+
+// CoverCount returns how many geohash cells of precision are needed to cover the box
+func CoverCount(box Box, precision int) int {
+	height, width := CellSize(precision)
+	lonSpan := box.Right - box.Left
+	if box.Left > box.Right {
+		lonSpan += 360
+	}
+	rows := int(math.Floor((box.Top+90)/height)-math.Floor((box.Bottom+90)/height)) + 1
+	cols := int(lonSpan/width) + 2
+	return rows * cols
+}
+
+// Precision returns the finest precision that covers the box in no more than maxCells cells
+func Precision(box Box, maxPrecision int, maxCells int) int {
+	for p := maxPrecision; p > 1; p-- {
+		if CoverCount(box, p) <= maxCells {
+			return p
+		}
+	}
+	return 1
+}
+
+func (b Box) String() string {
+	return fmt.Sprintf("[%v,%v,%v,%v]", b.Top, b.Left, b.Bottom, b.Right)
+}
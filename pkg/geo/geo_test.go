@@ -0,0 +1,65 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePoint(t *testing.T) {
+	p, err := ParsePoint("39.9, 116.4")
+	assert.Nil(t, err)
+	assert.Equal(t, Point{Lat: 39.9, Lon: 116.4}, p)
+	_, err = ParsePoint("91,116.4")
+	assert.NotNil(t, err)
+	_, err = ParsePoint("39.9")
+	assert.NotNil(t, err)
+}
+
+func TestParseDistance(t *testing.T) {
+	d, err := ParseDistance("10km")
+	assert.Nil(t, err)
+	assert.Equal(t, 10000.0, d)
+	d, err = ParseDistance("500m")
+	assert.Nil(t, err)
+	assert.Equal(t, 500.0, d)
+	d, err = ParseDistance("20")
+	assert.Nil(t, err)
+	assert.Equal(t, 20.0, d)
+	_, err = ParseDistance("km")
+	assert.NotNil(t, err)
+}
+
+func TestEncode(t *testing.T) {
+	assert.Equal(t, "u4pruydqqvj", Encode(Point{Lat: 57.64911, Lon: 10.40744}, 11))
+	assert.Equal(t, "wx4f", Encode(Point{Lat: 39.9, Lon: 116.4}, 4))
+}
+
+func TestDistance(t *testing.T) {
+	beijing := Point{Lat: 39.9042, Lon: 116.4074}
+	shanghai := Point{Lat: 31.2304, Lon: 121.4737}
+	d := Distance(beijing, shanghai)
+	assert.InDelta(t, 1067000, d, 5000)
+	assert.Equal(t, 0.0, Distance(beijing, beijing))
+}
+
+func TestCover(t *testing.T) {
+	center := Point{Lat: 39.9, Lon: 116.4}
+	box := CircleBox(center, 10000)
+	assert.True(t, box.Contains(center))
+	assert.True(t, box.Contains(Point{Lat: 39.98, Lon: 116.4}))
+	assert.False(t, box.Contains(Point{Lat: 40.1, Lon: 116.4}))
+	p := Precision(box, 8, 64)
+	cells := Cover(box, p)
+	assert.True(t, len(cells) <= 64)
+	hash := Encode(center, p)
+	assert.Contains(t, cells, hash)
+
+	crossing := Box{Top: 10, Left: 179, Bottom: -10, Right: -179}
+	assert.True(t, crossing.Contains(Point{Lat: 0, Lon: 180}))
+	assert.True(t, crossing.Contains(Point{Lat: 0, Lon: -179.5}))
+	assert.False(t, crossing.Contains(Point{Lat: 0, Lon: 0}))
+	cells = Cover(crossing, 2)
+	assert.Contains(t, cells, Encode(Point{Lat: 0, Lon: 179.5}, 2))
+	assert.Contains(t, cells, Encode(Point{Lat: 0, Lon: -179.5}, 2))
+}
@@ -0,0 +1,106 @@
+package skeleton
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Bitmap is a growable set of uint64
+type Bitmap struct {
+	words []uint64
+	sync.RWMutex
+}
+
+// NewBitmap initializes a bitmap
+func NewBitmap() *Bitmap {
+	return &Bitmap{
+		words: make([]uint64, 0),
+	}
+}
+
+func (b *Bitmap) String() string {
+	return fmt.Sprintf("bitmap, words: %v, count: %v", len(b.words), b.Count())
+}
+
+// Set adds i into bitmap
+func (b *Bitmap) Set(i uint64) {
+	b.Lock()
+	defer b.Unlock()
+	pos := int(i / 64)
+	for len(b.words) <= pos {
+		b.words = append(b.words, 0)
+	}
+	b.words[pos] |= 1 << (i % 64)
+}
+
+// Has checks if i is in bitmap
+func (b *Bitmap) Has(i uint64) bool {
+	b.RLock()
+	defer b.RUnlock()
+	pos := int(i / 64)
+	if pos >= len(b.words) {
+		return false
+	}
+	return b.words[pos]&(1<<(i%64)) != 0
+}
+
+// Count returns the number of elements in bitmap
+func (b *Bitmap) Count() uint64 {
+	b.RLock()
+	defer b.RUnlock()
+	var count uint64
+	for _, w := range b.words {
+		for w != 0 {
+			w &= w - 1
+			count++
+		}
+	}
+	return count
+}
+
+// Load reads bitmap from a file
+func (b *Bitmap) Load(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	words := make([]uint64, fileInfo.Size()/8)
+	if err = binary.Read(file, binary.LittleEndian, words); err != nil {
+		return err
+	}
+	b.words = words
+	return nil
+}
+
+// Save persists bitmap into a file
+func (b *Bitmap) Save(filename string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	b.RLock()
+	buf := new(bytes.Buffer)
+	err = binary.Write(buf, binary.LittleEndian, b.words)
+	b.RUnlock()
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package skeleton
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitmap_Set_Has_Count(t *testing.T) {
+	bitmap := NewBitmap()
+	bitmap.Set(0)
+	bitmap.Set(63)
+	bitmap.Set(64)
+	bitmap.Set(1000)
+	assert.True(t, bitmap.Has(0))
+	assert.True(t, bitmap.Has(63))
+	assert.True(t, bitmap.Has(64))
+	assert.True(t, bitmap.Has(1000))
+	assert.False(t, bitmap.Has(1))
+	assert.False(t, bitmap.Has(5000))
+	assert.Equal(t, uint64(4), bitmap.Count())
+}
+
+func TestBitmap_Save_Load(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	bitmap := NewBitmap()
+	bitmap.Set(3)
+	bitmap.Set(129)
+	err = bitmap.Save(path + "/field.bitmap")
+	assert.Nil(t, err)
+
+	loaded := NewBitmap()
+	err = loaded.Load(path + "/field.bitmap")
+	assert.Nil(t, err)
+	assert.True(t, loaded.Has(3))
+	assert.True(t, loaded.Has(129))
+	assert.False(t, loaded.Has(4))
+}
@@ -191,19 +191,19 @@ func (h *HashMap) Set(key string, val uint64) error {
 
 // Get fetches value by key if key is found
 func (h *HashMap) Get(key string) (uint64, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	if !h.available || h.buckets == 0 {
+		return 0, false
+	}
+
 	h0 := hashCode(key, hash0)
 	ha := hashCode(key, hashA)
 	hb := hashCode(key, hashB)
 	pos := h0 % uint64(h.buckets)
-
-	h.RLock()
-	defer h.RUnlock()
 	if !h.hashtable[pos].isOld {
 		return 0, false
 	}
-	if len(h.hashtable[pos].entries) == 1 {
-		return h.hashtable[pos].entries[0].Value, true
-	}
 	for _, e := range h.hashtable[pos].entries {
 		if e.HashA == ha && e.HashB == hb {
 			return e.Value, true
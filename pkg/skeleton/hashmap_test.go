@@ -1,6 +1,7 @@
 package skeleton
 
 import (
+	"fmt"
 	"testing"
 
 	"bytes"
@@ -53,3 +54,29 @@ func TestHashmap_Push_Set_Get(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, uint64(1), val2)
 }
+
+func TestHashmap_Get_MissingKey(t *testing.T) {
+	hashmap := mockedHashmap()
+	pos := hashCode("key1", hash0) % hashmap.buckets
+	assert.Len(t, hashmap.hashtable[pos].entries, 1)
+	// a missing key in the bucket of key1 must not be taken for it
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("missing%d", i)
+		if hashCode(key, hash0)%hashmap.buckets == pos {
+			_, ok := hashmap.Get(key)
+			assert.False(t, ok)
+			return
+		}
+	}
+	t.Fatal("no missing key in the bucket of key1")
+}
+
+func TestHashmap_Get_Unavailable(t *testing.T) {
+	hashmap := NewHashMap()
+	_, ok := hashmap.Get("key1")
+	assert.False(t, ok)
+
+	_ = hashmap.Push("key1", uint64(0))
+	_, ok = hashmap.Get("key1")
+	assert.False(t, ok)
+}
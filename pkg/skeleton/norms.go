@@ -0,0 +1,97 @@
+package skeleton
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Norms is a growable array of uint32 indexed by docid, e.g. lengths of a field in documents
+type Norms struct {
+	values []uint32
+	sync.RWMutex
+}
+
+// NewNorms initializes norms
+func NewNorms() *Norms {
+	return &Norms{
+		values: make([]uint32, 0),
+	}
+}
+
+func (n *Norms) String() string {
+	return fmt.Sprintf("norms, values: %v", len(n.values))
+}
+
+// Set sets value of i
+func (n *Norms) Set(i uint64, value uint32) {
+	n.Lock()
+	defer n.Unlock()
+	for uint64(len(n.values)) <= i {
+		n.values = append(n.values, 0)
+	}
+	n.values[i] = value
+}
+
+// Get returns value of i, 0 if it's not set
+func (n *Norms) Get(i uint64) uint32 {
+	n.RLock()
+	defer n.RUnlock()
+	if i >= uint64(len(n.values)) {
+		return 0
+	}
+	return n.values[i]
+}
+
+// Len returns the number of values, i.e. the max i set plus 1
+func (n *Norms) Len() uint64 {
+	n.RLock()
+	defer n.RUnlock()
+	return uint64(len(n.values))
+}
+
+// Load reads norms from a file
+func (n *Norms) Load(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	values := make([]uint32, fileInfo.Size()/4)
+	if err = binary.Read(file, binary.LittleEndian, values); err != nil {
+		return err
+	}
+	n.values = values
+	return nil
+}
+
+// Save persists norms into a file
+func (n *Norms) Save(filename string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	n.RLock()
+	buf := new(bytes.Buffer)
+	err = binary.Write(buf, binary.LittleEndian, n.values)
+	n.RUnlock()
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package skeleton
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNorms_Set_Get(t *testing.T) {
+	norms := NewNorms()
+	norms.Set(0, 3)
+	norms.Set(100, 7)
+	assert.Equal(t, uint32(3), norms.Get(0))
+	assert.Equal(t, uint32(7), norms.Get(100))
+	assert.Equal(t, uint32(0), norms.Get(50))
+	assert.Equal(t, uint32(0), norms.Get(5000))
+	assert.Equal(t, uint64(101), norms.Len())
+}
+
+func TestNorms_Save_Load(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	norms := NewNorms()
+	norms.Set(1, 4)
+	norms.Set(9, 12)
+	err = norms.Save(path + "/field.norms")
+	assert.Nil(t, err)
+
+	loaded := NewNorms()
+	err = loaded.Load(path + "/field.norms")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), loaded.Get(1))
+	assert.Equal(t, uint32(12), loaded.Get(9))
+	assert.Equal(t, uint32(0), loaded.Get(2))
+}
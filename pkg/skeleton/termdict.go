@@ -0,0 +1,188 @@
+package skeleton
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TermDict holds terms in lexicographic order so that they can be iterated by prefix
+type TermDict struct {
+	terms  []string
+	values []uint64
+	sorted bool
+	sync.RWMutex
+}
+
+// NewTermDict initializes a term dictionary
+func NewTermDict() *TermDict {
+	return &TermDict{
+		terms:  make([]string, 0),
+		values: make([]uint64, 0),
+		sorted: true,
+	}
+}
+
+func (d *TermDict) String() string {
+	return fmt.Sprintf("termdict, length: %v", d.Len())
+}
+
+// Set inserts or updates term
+func (d *TermDict) Set(term string, value uint64) error {
+	d.Lock()
+	defer d.Unlock()
+	d.sort()
+	i := sort.SearchStrings(d.terms, term)
+	if i < len(d.terms) && d.terms[i] == term {
+		d.values[i] = value
+		return nil
+	}
+	d.terms = append(d.terms, "")
+	d.values = append(d.values, 0)
+	copy(d.terms[i+1:], d.terms[i:])
+	copy(d.values[i+1:], d.values[i:])
+	d.terms[i] = term
+	d.values[i] = value
+	return nil
+}
+
+// Push appends term without checking duplicates, terms are sorted before read
+func (d *TermDict) Push(term string, value uint64) error {
+	d.Lock()
+	defer d.Unlock()
+	if n := len(d.terms); n > 0 && d.terms[n-1] > term {
+		d.sorted = false
+	}
+	d.terms = append(d.terms, term)
+	d.values = append(d.values, value)
+	return nil
+}
+
+// Get returns value of term
+func (d *TermDict) Get(term string) (uint64, bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.sort()
+	i := sort.SearchStrings(d.terms, term)
+	if i < len(d.terms) && d.terms[i] == term {
+		return d.values[i], true
+	}
+	return 0, false
+}
+
+// Len returns the number of terms
+func (d *TermDict) Len() int {
+	d.RLock()
+	defer d.RUnlock()
+	return len(d.terms)
+}
+
+// Seek returns index of the first term not less than term
+func (d *TermDict) Seek(term string) int {
+	d.Lock()
+	defer d.Unlock()
+	d.sort()
+	return sort.SearchStrings(d.terms, term)
+}
+
+// Term returns the ith term and its value
+func (d *TermDict) Term(i int) (string, uint64) {
+	d.RLock()
+	defer d.RUnlock()
+	return d.terms[i], d.values[i]
+}
+
+// Prefix calls fn with terms starting with prefix in order until fn returns false
+func (d *TermDict) Prefix(prefix string, fn func(term string, value uint64) bool) {
+	n := d.Len()
+	for i := d.Seek(prefix); i < n; i++ {
+		term, value := d.Term(i)
+		if !strings.HasPrefix(term, prefix) || !fn(term, value) {
+			return
+		}
+	}
+}
+
+// Load reads terms from a file
+func (d *TermDict) Load(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var terms []string
+	var values []uint64
+	reader := bufio.NewReader(file)
+	for {
+		var header [2]uint64
+		if err = binary.Read(reader, binary.LittleEndian, &header); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		term := make([]byte, header[1])
+		if _, err = io.ReadFull(reader, term); err != nil {
+			return err
+		}
+		terms = append(terms, string(term))
+		values = append(values, header[0])
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.terms = terms
+	d.values = values
+	d.sorted = false
+	d.sort()
+	return nil
+}
+
+// Save persists terms into a file, each term is stored as value, length and bytes of term
+func (d *TermDict) Save(filename string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	d.Lock()
+	defer d.Unlock()
+	d.sort()
+	writer := bufio.NewWriter(file)
+	for i, term := range d.terms {
+		header := [2]uint64{d.values[i], uint64(len(term))}
+		if err = binary.Write(writer, binary.LittleEndian, header); err != nil {
+			return err
+		}
+		if _, err = writer.WriteString(term); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// sort must be called with lock held
+func (d *TermDict) sort() {
+	if d.sorted {
+		return
+	}
+	sort.Sort(termSort{d})
+	d.sorted = true
+}
+
+type termSort struct {
+	d *TermDict
+}
+
+func (t termSort) Len() int           { return len(t.d.terms) }
+func (t termSort) Less(i, j int) bool { return t.d.terms[i] < t.d.terms[j] }
+func (t termSort) Swap(i, j int) {
+	t.d.terms[i], t.d.terms[j] = t.d.terms[j], t.d.terms[i]
+	t.d.values[i], t.d.values[j] = t.d.values[j], t.d.values[i]
+}
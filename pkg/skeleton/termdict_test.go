@@ -0,0 +1,66 @@
+package skeleton
+
+import (
+	"testing"
+
+	"github.com/cosmtrek/violet/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTermDict_Push_Get(t *testing.T) {
+	dict := NewTermDict()
+	dict.Push("tom", 3)
+	dict.Push("brady", 1)
+	dict.Push("bowl", 0)
+	dict.Set("super", 2)
+	value, ok := dict.Get("brady")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), value)
+	value, ok = dict.Get("super")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), value)
+	_, ok = dict.Get("brad")
+	assert.False(t, ok)
+	assert.Equal(t, 4, dict.Len())
+	term, _ := dict.Term(0)
+	assert.Equal(t, "bowl", term)
+}
+
+func TestTermDict_Prefix(t *testing.T) {
+	dict := NewTermDict()
+	for i, term := range []string{"brady", "brad", "bowl", "bradley", "电台", "电影", "电"} {
+		dict.Push(term, uint64(i))
+	}
+	var terms []string
+	dict.Prefix("brad", func(term string, _ uint64) bool {
+		terms = append(terms, term)
+		return true
+	})
+	assert.Equal(t, []string{"brad", "bradley", "brady"}, terms)
+	terms = nil
+	dict.Prefix("电", func(term string, _ uint64) bool {
+		terms = append(terms, term)
+		return len(terms) < 2
+	})
+	assert.Equal(t, []string{"电", "电台"}, terms)
+}
+
+func TestTermDict_Save_Load(t *testing.T) {
+	path, err := utils.TempDir("", true)
+	assert.Nil(t, err)
+	dict := NewTermDict()
+	dict.Push("tom", 3)
+	dict.Push("brady", 1)
+	dict.Push("诗歌", 8)
+	assert.Nil(t, dict.Save(path+"terms.dic"))
+
+	loaded := NewTermDict()
+	assert.Nil(t, loaded.Load(path+"terms.dic"))
+	assert.Equal(t, 3, loaded.Len())
+	value, ok := loaded.Get("诗歌")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(8), value)
+	term, value := loaded.Term(0)
+	assert.Equal(t, "brady", term)
+	assert.Equal(t, uint64(1), value)
+}